@@ -5,14 +5,17 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"chatto/internal/constant"
 	pg_repo "chatto/internal/repository/pg"
 	"chatto/internal/repository/redis"
 	"chatto/internal/rest/middleware"
+	"chatto/internal/ws/cluster"
 	"chatto/internal/ws/manager"
 
 	"chatto/internal/config"
@@ -54,10 +57,11 @@ func (a *Application) openDatabase() (*gorm.DB, error) {
 		Conn: conn,
 	}))
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&model.User{}, &model.Credential{}, &model.Room{}, &model.UserRoom{})
+	err = db.AutoMigrate(&model.User{}, &model.Credential{}, &model.Room{}, &model.UserRoom{}, &model.Workspace{}, &model.WorkspaceMember{})
 	return db, err
 }
 
@@ -66,6 +70,8 @@ func (a *Application) openRedisDatabase() (*redis.Client, error) {
 		Addr:     a.Config.ChatDatabaseURI,
 		Username: a.Config.ChatDatabaseUsername,
 		Password: a.Config.ChatDatabasePassword,
+		// Broadcast path relies on the context deadline, so slow redis doesn't hold back the delivery
+		ContextTimeoutEnabled: true,
 	}
 	client := redis.NewClient(&opt)
 	if client == nil {
@@ -90,7 +96,13 @@ func (a *Application) setupRedisIndexes(client *redis.Client) error {
 	if resInfo.Err() != nil {
 		// Setup index
 		resInfo = client.Do(context.Background(), "FT.CREATE", constant.REDIS_KEY_USER_INDEX, "ON", "HASH", "PREFIX", 1, constant.REDIS_KEY_USER,
-			"SCHEMA", "name", "TEXT", "SORTABLE", "role", "TEXT", "SORTABLE", "online", "NUMERIC", "SORTABLE")
+			"SCHEMA", "name", "TEXT", "SORTABLE", "role", "TEXT", "SORTABLE", "online", "NUMERIC", "SORTABLE", "status", "TAG")
+		if resInfo.Err() != nil {
+			return resInfo.Err()
+		}
+	} else if !indexHasAttribute(resInfo.Val(), "status") {
+		// Index created before presence status exists
+		resInfo = client.Do(context.Background(), "FT.ALTER", constant.REDIS_KEY_USER_INDEX, "SCHEMA", "ADD", "status", "TAG")
 		if resInfo.Err() != nil {
 			return resInfo.Err()
 		}
@@ -100,7 +112,14 @@ func (a *Application) setupRedisIndexes(client *redis.Client) error {
 	if resInfo.Err() != nil {
 		// Setup index
 		resInfo = client.Do(context.Background(), "FT.CREATE", constant.REDIS_KEY_CHAT_INDEX, "ON", "JSON", "PREFIX", 1, constant.REDIS_KEY_CHAT,
-			"SCHEMA", "$.id", "as", "id", "TAG", "$.sender_id", "as", "sender", "TAG", "$.receiver_id", "as", "receiver", "TAG", "$.message", "as", "message", "TEXT", "$.ts", "as", "timestamp", "NUMERIC", "SORTABLE")
+			"SCHEMA", "$.id", "as", "id", "TAG", "$.sender_id", "as", "sender", "TAG", "$.receiver_id", "as", "receiver", "TAG", "$.message", "as", "message", "TEXT", "$.ts", "as", "timestamp", "NUMERIC", "SORTABLE",
+			"$.seq", "as", "seq", "NUMERIC", "SORTABLE")
+		if resInfo.Err() != nil {
+			return resInfo.Err()
+		}
+	} else if !indexHasAttribute(resInfo.Val(), "seq") {
+		// Index created before room sequence exists
+		resInfo = client.Do(context.Background(), "FT.ALTER", constant.REDIS_KEY_CHAT_INDEX, "SCHEMA", "ADD", "$.seq", "as", "seq", "NUMERIC", "SORTABLE")
 		if resInfo.Err() != nil {
 			return resInfo.Err()
 		}
@@ -119,16 +138,52 @@ func (a *Application) setupRedisIndexes(client *redis.Client) error {
 	return nil
 }
 
+// indexHasAttribute Used to check if the FT.INFO result contains the attribute
+func indexHasAttribute(info any, name string) bool {
+	switch val := info.(type) {
+	case []any:
+		for i, elem := range val {
+			if key, ok := elem.(string); ok && key == "attribute" && i+1 < len(val) && val[i+1] == name {
+				return true
+			}
+			if indexHasAttribute(elem, name) {
+				return true
+			}
+		}
+	case map[any]any:
+		for _, elem := range val {
+			if indexHasAttribute(elem, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (a *Application) stopRedis(client *redis.Client) {
 	if err := client.Close(); err != nil {
 		log.Println(err)
 	}
 }
+
+// stopDatabase Used to close the database connection pool
+func (a *Application) stopDatabase(db *gorm.DB) {
+	conn, err := db.DB()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err = conn.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
 func (a *Application) Start() {
 	db, err := a.openDatabase()
 	if err != nil {
 		log.Fatalln(err)
 	}
+	defer a.stopDatabase(db)
 
 	redisDb, err := a.openRedisDatabase()
 	if err != nil {
@@ -154,17 +209,56 @@ func (a *Application) Start() {
 	roomRepo := pg_repo.NewRoomRepository(db)
 	roomService := service.NewRoomService(roomRepo, userRoomRepo)
 
+	// Private rooms created before the direct key exists would be duplicated by open-dm
+	backfilled, err := roomRepo.BackfillDirectKeys()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Direct keys backfilled: ", backfilled)
+
+	workspaceRepo := pg_repo.NewWorkspaceRepository(db)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, roomRepo)
+
 	chatRepository := redis_repo.NewChatRepository(redisDb)
-	chatService := service.NewChatService(chatRepository, userService, roomService, &a.roomManager, &a.clientManager)
+	// Messages stored before the room sequence could not be paginated
+	migrated, err := chatRepository.MigrateLegacyChats()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Legacy messages migrated: ", migrated)
+	pushService := service.NewPushService(a.Config)
+	chatService := service.NewChatService(chatRepository, userService, roomService, workspaceService, pushService, &a.roomManager, &a.clientManager)
+	a.roomManager.SetRecorder(chatService.RecordEvent)
+	a.clientManager.SetRecorder(chatService.RecordEvent)
+
+	if a.Config.ClusterMode {
+		bus := cluster.NewBus(a.Config.NodeId, redisDb, &a.roomManager, &a.clientManager)
+		bus.SetMembershipHandler(func(roomIds []string) {
+			if cerr := chatService.SyncRooms(roomIds...); cerr.IsError() {
+				log.Println(cerr.Error())
+			}
+		})
+		if err = bus.Start(); err != nil {
+			log.Fatalln(err)
+		}
+		defer bus.Stop()
+
+		a.roomManager.SetPublisher(bus.PublishRoom)
+		a.roomManager.SetMembershipPublisher(bus.PublishMembership)
+		a.clientManager.SetPublisher(bus)
+		log.Println("Cluster mode enabled on node: ", bus.NodeId())
+	}
 
 	// Rest Server
 	restServer := rest.Server{
-		Config:      a.Config,
-		Router:      a.App,
-		UserService: userService,
-		AuthService: authService,
-		RoomService: roomService,
-		Middleware:  &mw,
+		Config:           a.Config,
+		Router:           a.App,
+		UserService:      userService,
+		AuthService:      authService,
+		RoomService:      roomService,
+		ChatService:      chatService,
+		WorkspaceService: workspaceService,
+		Middleware:       &mw,
 	}
 	restServer.Setup()
 
@@ -183,16 +277,29 @@ func (a *Application) Start() {
 	wsServer := ws.NewWebsocketServer(&wsConfig)
 	wsServer.Setup()
 
+	server := &http.Server{
+		Addr:    a.Config.Address,
+		Handler: a.App,
+	}
 	go func() {
-		if err := a.App.Run(a.Config.Address); err != nil {
+		log.Println("Listening on: ", a.Config.Address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalln(err)
 		}
 	}()
 
 	// Create graceful stop
-	quitChan := make(chan os.Signal)
+	quitChan := make(chan os.Signal, 1)
 	signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	<-quitChan
+	log.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.Config.ShutdownTimeout)*time.Second)
+	defer cancel()
 
-	wsServer.Stop()
+	// Stop accepting new connections, the websocket connections are drained by the websocket server
+	if err = server.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
+	wsServer.Stop(ctx)
 }
@@ -1,13 +1,17 @@
 package config
 
 import (
+	"chatto/internal/constant"
+	"chatto/internal/model"
 	"chatto/internal/util/strutil"
 	"errors"
 	"log"
 	"net/http"
+	"runtime"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/spf13/viper"
 )
@@ -15,6 +19,8 @@ import (
 const (
 	accessTokenDuration  = time.Minute * 60
 	refreshTokenDuration = time.Hour * 24 * 90
+	idleTimeout          = 5
+	reconcileInterval    = 5
 )
 
 type AppConfig struct {
@@ -35,6 +41,33 @@ type AppConfig struct {
 	AccessTokenDuration  uint64 `mapstructure:"ACCESS_TOKEN_DURATION"`
 	RefreshTokenDuration uint64 `mapstructure:"REFRESH_TOKEN_DURATION"`
 
+	// Duration is in minutes, users will be seen as away when all the clients are inactive for the duration. Zero will disable it
+	IdleTimeout uint64 `mapstructure:"IDLE_TIMEOUT"`
+
+	// Duration is in seconds, the websocket connection is closed when no pong message or payload is received within the read timeout
+	PingInterval uint64 `mapstructure:"PING_INTERVAL"`
+	ReadTimeout  uint64 `mapstructure:"READ_TIMEOUT"`
+	WriteTimeout uint64 `mapstructure:"WRITE_TIMEOUT"`
+
+	// Duration is in seconds, the clients outbound queues are flushed within the timeout when the server is shutting down
+	ShutdownTimeout uint64 `mapstructure:"SHUTDOWN_TIMEOUT"`
+
+	// Outbound queue size of each client, the policy is applied when the queue is full. See model.OutboundPolicy
+	OutboundQueueSize int                  `mapstructure:"OUTBOUND_QUEUE_SIZE"`
+	OutboundPolicy    model.OutboundPolicy `mapstructure:"OUTBOUND_POLICY"`
+
+	// Number of workers handling the payloads, payloads of the same room are always handled by the same worker
+	PayloadShards int `mapstructure:"PAYLOAD_SHARDS"`
+
+	// Cluster mode is used when running multiple nodes sharing the same Redis, the node id is generated when it is empty
+	ClusterMode bool   `mapstructure:"CLUSTER_MODE"`
+	NodeId      string `mapstructure:"NODE_ID"`
+	// Duration is in minutes, the rooms of each node are reloaded from the database periodically on cluster mode. Zero will disable it
+	ReconcileInterval uint64 `mapstructure:"RECONCILE_INTERVAL"`
+
+	// Push notifications are sent into the webhook, it is disabled when the url is empty
+	PushWebhookURL string `mapstructure:"PUSH_WEBHOOK_URL"`
+
 	JWTKeyFunc jwt.Keyfunc
 }
 
@@ -47,6 +80,15 @@ func LoadConfig(path string) (AppConfig, error) {
 	viper.SetDefault("LISTEN_PORT", 9999)
 	viper.SetDefault("ACCESS_TOKEN_DURATION", accessTokenDuration)
 	viper.SetDefault("REFRESH_TOKEN_DURATION", refreshTokenDuration)
+	viper.SetDefault("IDLE_TIMEOUT", idleTimeout)
+	viper.SetDefault("PING_INTERVAL", uint64(constant.CLIENT_PING_INTERVAL/time.Second))
+	viper.SetDefault("READ_TIMEOUT", uint64(constant.CLIENT_READ_LIMIT_TIME/time.Second))
+	viper.SetDefault("WRITE_TIMEOUT", uint64(constant.CLIENT_WRITE_LIMIT_TIME/time.Second))
+	viper.SetDefault("SHUTDOWN_TIMEOUT", uint64(constant.SHUTDOWN_TIMEOUT/time.Second))
+	viper.SetDefault("OUTBOUND_QUEUE_SIZE", constant.CLIENT_OUTBOUND_QUEUE_SIZE)
+	viper.SetDefault("OUTBOUND_POLICY", string(model.OutboundDropOldest))
+	viper.SetDefault("PAYLOAD_SHARDS", runtime.NumCPU())
+	viper.SetDefault("RECONCILE_INTERVAL", reconcileInterval)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return AppConfig{}, err
@@ -64,6 +106,15 @@ func LoadConfig(path string) (AppConfig, error) {
 	if strutil.IsEmpty(conf.JWTSecretKey) && strutil.IsEmpty(conf.JWTSecretKeyURI) {
 		return conf, errors.New("JWT secret key should not be absent, set JWT_SECRET_KEY on env")
 	}
+	if conf.PingInterval == 0 || conf.PingInterval >= conf.ReadTimeout {
+		return conf, errors.New("ping interval should be greater than 0 and less than read timeout, set PING_INTERVAL and READ_TIMEOUT on env")
+	}
+	if strutil.IsEmpty(conf.NodeId) {
+		conf.NodeId = uuid.NewString()
+	}
+	if conf.OutboundQueueSize <= 0 || !model.IsValidOutboundPolicy(conf.OutboundPolicy) {
+		return conf, errors.New("outbound queue size should be greater than 0 and the policy should be either drop-oldest, coalesce or disconnect, set OUTBOUND_QUEUE_SIZE and OUTBOUND_POLICY on env")
+	}
 	if strutil.IsEmpty(conf.JWTSigningType) {
 		return conf, errors.New("JWT Signing type should not be absent, set JWT_SIGNING_TYPE on env")
 	}
@@ -76,10 +127,10 @@ func LoadConfig(path string) (AppConfig, error) {
 	} else {
 		conf.JWTKeyFunc = func(token *jwt.Token) (interface{}, error) {
 			resp, err := http.Get(conf.JWTSecretKeyURI)
-			defer resp.Body.Close()
 			if err != nil {
 				return nil, err
 			}
+			defer resp.Body.Close()
 
 			var data []byte
 			_, err = resp.Body.Read(data)
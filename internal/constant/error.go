@@ -22,6 +22,8 @@ const (
 	MSG_ROOM_CREATION_FAILED     = "Could not create new room"
 	MSG_PRIVATE_ROOM_NOT_2_USER  = "Private room should only have 2 member"
 	MSG_ROOM_NOT_FOUND           = "Room doesn't exist"
+	MSG_ROOM_UPDATE_FAILED       = "Could not update room"
+	MSG_ROOM_ARCHIVED            = "Room is archived"
 	MSG_REMOVE_NON_EMPTY_ROOM    = "There are still users in the room"
 	MSG_JOIN_PRIVATE_ROOM        = "Could not join in private room"
 	MSG_INVITE_TO_PRIVATE_ROOM   = "Could not invite in private room"
@@ -31,6 +33,28 @@ const (
 	MSG_USER_NOT_ROOM_MEMBER     = "You are not room's member"
 	MSG_ROOM_ROLE_NOT_FOUND      = "Role should be either user or admin"
 	MSG_MEMBER_ROOM_NOT_FOUND    = "Member room not found"
+	MSG_MUTE_IN_PRIVATE_ROOM     = "Could not mute in private room"
+	MSG_MUTE_ROOM_ADMIN          = "Only the room's owner could mute the admin"
+	MSG_SLOW_MODE_PRIVATE_ROOM   = "Could not set slow mode in private room"
+	MSG_TRANSFER_PRIVATE_ROOM    = "Could not transfer private room"
+	MSG_OWNER_LEAVE_ROOM         = "Transfer the room's ownership before leaving"
+	MSG_KICK_ROOM_OWNER          = "Could not kick the room's owner"
+	MSG_GROUP_ROOM_MEMBER_LIMIT  = "Group room members exceed the limit"
+	MSG_GROUP_ROOM_EXISTS        = "Group room with the same members already exists"
+	MSG_NOTIF_LEVEL_NOT_FOUND    = "Notification level should be either all, mentions or none"
+)
+
+// Workspace
+const (
+	MSG_WORKSPACE_CREATION_FAILED  = "Could not create new workspace"
+	MSG_WORKSPACE_NOT_FOUND        = "Workspace doesn't exist"
+	MSG_WORKSPACE_UPDATE_FAILED    = "Could not update workspace"
+	MSG_NOT_WORKSPACE_MEMBER       = "You are not workspace's member"
+	MSG_USER_NOT_WORKSPACE_MEMBER  = "User is not workspace's member"
+	MSG_REMOVE_NON_EMPTY_WORKSPACE = "There are still rooms in the workspace"
+	MSG_OWNER_LEAVE_WORKSPACE      = "Workspace's owner could not leave the workspace"
+	MSG_WORKSPACE_ROLE_NOT_FOUND   = "Role should be either member or admin"
+	MSG_DEFAULT_ROOM_NOT_ALLOWED   = "Only workspace's admin could create default room"
 )
 
 // Auth
@@ -56,7 +80,19 @@ const (
 
 // Chat
 const (
-	MSG_BAD_FORMAT_PAYLOAD = "Payload is malformed"
-	ERR_CLIENT_NOT_EXIST   = "User is not exist"
-	ERR_ROOM_NOT_EXIST     = "Room is not exist"
+	MSG_BAD_FORMAT_PAYLOAD          = "Payload is malformed"
+	MSG_USER_MUTED                  = "You are muted in this room"
+	MSG_SLOW_MODE_ACTIVE            = "Slow mode is enabled, please wait before sending another message"
+	MSG_PRESENCE_NOT_FOUND          = "Presence status should be either online, away, busy or invisible"
+	MSG_PRESENCE_SUBSCRIPTION_LIMIT = "Too many presence subscriptions, please unsubscribe some users first"
+	MSG_PAYLOAD_OVERLOADED          = "Too many payloads are waiting on this room, please try again later"
+	ERR_CLIENT_NOT_EXIST            = "User is not exist"
+	ERR_ROOM_NOT_EXIST              = "Room is not exist"
+)
+
+// Protocol
+const (
+	MSG_UNSUPPORTED_PROTOCOL = "Protocol version is not supported"
+	MSG_UNSUPPORTED_PAYLOAD  = "Payload is not supported by the negotiated protocol"
+	MSG_HELLO_NOT_FIRST      = "Hello should be the first payload"
 )
@@ -11,7 +11,25 @@ const (
 	REDIS_KEY_USER        = "user:"
 	REDIS_KEY_CHAT        = "chat:"
 	REDIS_KEY_NOTIF       = "notif:"
+	REDIS_KEY_ROOM        = "room:"
+	REDIS_KEY_MUTE        = "mute:"
+	REDIS_KEY_SLOW_MODE   = "slow:"
+	REDIS_KEY_SESSION     = "session:"
+	REDIS_KEY_EVENT_SEQ   = "seq:"
+	REDIS_KEY_EVENTS      = "events:"
+	REDIS_KEY_ACTIVE      = "active:"
 	REDIS_KEY_CHAT_INDEX  = "chat_index"
 	REDIS_KEY_NOTIF_INDEX = "notif_index"
 	REDIS_KEY_USER_INDEX  = "user_index"
+
+	// REDIS_KEY_MIGRATION_CHAT_SEQ Used to mark that the messages stored before the room sequence are migrated
+	REDIS_KEY_MIGRATION_CHAT_SEQ = "migration:chat-seq"
+)
+
+// Redis Cluster
+const (
+	REDIS_CHANNEL_ROOM       = "cluster:room"
+	REDIS_CHANNEL_USER       = "cluster:user"
+	REDIS_CHANNEL_PRESENCE   = "cluster:presence"
+	REDIS_CHANNEL_MEMBERSHIP = "cluster:membership"
 )
@@ -0,0 +1,7 @@
+package constant
+
+const (
+	ROOM_DIRECTORY_PAGE_SIZE     = 20
+	ROOM_DIRECTORY_MAX_PAGE_SIZE = 100
+	GROUP_ROOM_MAX_MEMBERS       = 10
+)
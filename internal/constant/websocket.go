@@ -4,7 +4,74 @@ import "time"
 
 const (
 	CLIENT_READ_LIMIT_SIZE = 4096
-	CLIENT_READ_LIMIT_TIME = time.Minute * 10
+	// CLIENT_READ_LIMIT_TIME Default duration to wait for the pong message or any payload before the connection is closed
+	CLIENT_READ_LIMIT_TIME = time.Second * 60
+	// CLIENT_PING_INTERVAL Default interval of the ping message, it should be less than CLIENT_READ_LIMIT_TIME
+	CLIENT_PING_INTERVAL = time.Second * 54
+	// CLIENT_WRITE_LIMIT_TIME Default duration to wait for each write into the client
+	CLIENT_WRITE_LIMIT_TIME = time.Second * 10
+	// CLIENT_OUTBOUND_QUEUE_SIZE Default number of payloads that could be queued for each client
+	CLIENT_OUTBOUND_QUEUE_SIZE = 100
+	// CLIENT_IDLE_CHECK_INTERVAL Interval to check the inactive clients
+	CLIENT_IDLE_CHECK_INTERVAL = time.Second * 30
+)
+
+const (
+	// SHUTDOWN_TIMEOUT Default duration to flush the clients outbound queues when the server is shutting down
+	SHUTDOWN_TIMEOUT = time.Second * 30
+	// SHUTDOWN_RECONNECT_DELAY Maximum delay suggested to the clients before reconnecting, the delay is randomized so the clients don't reconnect at once
+	SHUTDOWN_RECONNECT_DELAY = time.Second * 5
+	// CLOSE_REASON_SHUTDOWN Reason of the close message sent when the server is shutting down
+	CLOSE_REASON_SHUTDOWN = "server shutting down"
+	// CLOSE_REASON_UNSUPPORTED_PROTOCOL Reason of the close message sent when the client's protocol version is too old
+	CLOSE_REASON_UNSUPPORTED_PROTOCOL = "unsupported protocol version"
+)
+
+const (
+	// CLUSTER_PUBLISH_BUFFER_SIZE Number of events that could be queued before published into the other nodes
+	CLUSTER_PUBLISH_BUFFER_SIZE = 1000
+	// CLUSTER_DEDUP_SIZE Number of the latest received event ids kept to ignore duplicated events
+	CLUSTER_DEDUP_SIZE = 10000
+)
+
+const (
+	// PAYLOAD_SHARD_BUFFER_SIZE Number of payloads that could be queued on each payload worker
+	PAYLOAD_SHARD_BUFFER_SIZE = 100
+)
+
+const (
+	// PUSH_WORKER_COUNT Number of workers sending the push notifications of the new messages
+	PUSH_WORKER_COUNT = 4
+	// PUSH_QUEUE_SIZE Number of messages that could wait for the push workers, the push is dropped when the queue is full
+	PUSH_QUEUE_SIZE = 1000
+)
+
+const (
+	// TYPING_THROTTLE_DURATION Minimum interval of typing event sent by each client on the room
+	TYPING_THROTTLE_DURATION = time.Second * 3
+	// TYPING_EXPIRATION_DURATION Duration until the stop typing event is sent when the client is not typing anymore
+	TYPING_EXPIRATION_DURATION = time.Second * 6
+)
+
+const (
+	// SESSION_EXPIRATION_DURATION Duration that the session could still be resumed after the client is disconnected
+	SESSION_EXPIRATION_DURATION = time.Hour * 24
+	// USER_EVENT_STREAM_SIZE Number of the latest events kept for each user, the older events could not be replayed
+	USER_EVENT_STREAM_SIZE = 1000
+	// USER_EVENT_EXPIRATION_DURATION Duration that the events are kept after the latest event of the user
+	USER_EVENT_EXPIRATION_DURATION = time.Hour * 24
+	// USER_EVENT_RECORD_TIMEOUT Maximum duration to record the broadcast, the broadcast is delivered without sequence when it is exceeded
+	USER_EVENT_RECORD_TIMEOUT = time.Millisecond * 500
+)
+
+const (
+	// PRESENCE_MAX_SUBSCRIPTIONS Maximum number of users that a client could subscribe the presence
+	PRESENCE_MAX_SUBSCRIPTIONS = 500
+)
+
+const (
+	// MESSAGE_MAX_PAGE_SIZE Maximum number of messages returned on each request
+	MESSAGE_MAX_PAGE_SIZE = 100
 )
 
 const (
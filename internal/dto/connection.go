@@ -0,0 +1,77 @@
+package dto
+
+import (
+	"time"
+
+	"chatto/internal/model"
+)
+
+func NewGoingAwayResponse(reason string, reconnectAfter time.Duration) GoingAwayResponse {
+	return GoingAwayResponse{
+		Reason:         reason,
+		ReconnectAfter: reconnectAfter.Milliseconds(),
+	}
+}
+
+// GoingAwayResponse Used to tell the client that the connection will be closed by the server
+type GoingAwayResponse struct {
+	Reason         string `json:"reason"`
+	ReconnectAfter int64  `json:"reconnect_after"` // Milliseconds to wait before reconnecting
+}
+
+// SessionInput Used to resume the previous session when reconnecting, the events after the sequence will be replayed
+type SessionInput struct {
+	SessionId string `form:"session_id"`
+	Seq       uint64 `form:"seq"`
+}
+
+func NewSessionResponse(sessionId string, seq uint64, resumed bool) SessionResponse {
+	return SessionResponse{
+		SessionId: sessionId,
+		Seq:       seq,
+		Resumed:   resumed,
+	}
+}
+
+// SessionResponse Used to tell the client its session, the client should keep the session id and the latest received sequence to resume it.
+// When it is not resumed, the missed events could not be replayed and the client should fetch the state again
+type SessionResponse struct {
+	SessionId string `json:"session_id"`
+	Seq       uint64 `json:"seq"` // The latest sequence, the replayed events are included
+	Resumed   bool   `json:"resumed"`
+}
+
+// HelloInput Used as the first payload of the client to negotiate the protocol, the client is treated as legacy when it doesn't send hello
+type HelloInput struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	ClientName      string   `json:"client_name"`
+	ClientVersion   string   `json:"client_version"`
+	Features        []string `json:"features"`
+}
+
+func NewHelloResponse(protocol *model.Protocol, limits ProtocolLimits) HelloResponse {
+	return HelloResponse{
+		ProtocolVersion:    protocol.Version,
+		MinProtocolVersion: model.ProtocolVersionMin,
+		Features:           protocol.Features(),
+		Limits:             limits,
+	}
+}
+
+// HelloResponse Used to answer the hello with the negotiated protocol, the client should not send the payloads of the features not listed
+type HelloResponse struct {
+	ProtocolVersion    int            `json:"protocol_version"`
+	MinProtocolVersion int            `json:"min_protocol_version"`
+	Features           []string       `json:"features"`
+	Limits             ProtocolLimits `json:"limits"`
+}
+
+// ProtocolLimits Used to tell the client the server's limits, the durations are in milliseconds
+type ProtocolLimits struct {
+	MaxFrameSize             int   `json:"max_frame_size"` // Bytes of each inbound frame
+	MaxPageSize              int   `json:"max_page_size"`
+	MaxPresenceSubscriptions int   `json:"max_presence_subscriptions"`
+	OutboundQueueSize        int   `json:"outbound_queue_size"`
+	PingInterval             int64 `json:"ping_interval"`
+	ReadTimeout              int64 `json:"read_timeout"`
+}
@@ -3,6 +3,7 @@ package dto
 import (
 	"time"
 
+	"chatto/internal/constant"
 	"chatto/internal/model"
 	"github.com/google/uuid"
 )
@@ -14,7 +15,7 @@ func NewMessageFromInput(sender *model.Client, message *MessageInput) model.Mess
 		SenderId:   sender.UserId,
 		ReceiverId: message.ReceiverId,
 		Message:    message.Message,
-		Timestamp:  time.Now().Unix(),
+		Timestamp:  time.Now().UnixMilli(),
 	}
 }
 
@@ -29,16 +30,19 @@ func NewMessageOutput(message *model.Message) MessageOutput {
 		SenderId:   message.SenderId,
 		ReceiverId: message.ReceiverId,
 		Message:    message.Message,
+		Seq:        message.Seq,
 		Timestamp:  message.Timestamp,
 	}
 }
 
+// MessageOutput Used to send the new message, the clients could detect missed messages by the gap on the room's sequence
 type MessageOutput struct {
 	Id         string `json:"id"`
 	SenderId   string `json:"sender"`
 	ReceiverId string `json:"receiver"`
 	Message    string `json:"message"`
-	Timestamp  int64  `json:"ts"`
+	Seq        uint64 `json:"seq"`
+	Timestamp  int64  `json:"ts"` // Unix time in milliseconds
 }
 
 func NewMessageForward(receiverId string, message *MessageOutput) ChatForward {
@@ -57,16 +61,29 @@ type ChatForward struct {
 	Timestamp  int64  `json:"ts"`
 }
 
+// MessageRequest Used to get the room messages ordered by the sequence, the time range is in unix milliseconds.
+// AfterSeq and BeforeSeq are used as the pagination cursor, zero cursor is ignored
 type MessageRequest struct {
-	RoomId   string `json:"room_id"`
-	FromTime int64  `json:"from_time"`
-	ToTime   int64  `json:"to_time"`
+	RoomId    string `json:"room_id"`
+	FromTime  int64  `json:"from_time"`
+	ToTime    int64  `json:"to_time"`
+	AfterSeq  uint64 `json:"after_seq"`
+	BeforeSeq uint64 `json:"before_seq"`
+	Limit     int    `json:"limit"`
+}
+
+// Normalize Used to keep the limit between 1 and constant.MESSAGE_MAX_PAGE_SIZE, zero limit will be the max page size
+func (m *MessageRequest) Normalize() {
+	if m.Limit <= 0 || m.Limit > constant.MESSAGE_MAX_PAGE_SIZE {
+		m.Limit = constant.MESSAGE_MAX_PAGE_SIZE
+	}
 }
 
 func NewMessageResponse(message *model.Message) MessageResponse {
 	return MessageResponse{
 		SenderId:  message.SenderId,
 		Message:   message.Message,
+		Seq:       message.Seq,
 		Timestamp: message.Timestamp,
 	}
 }
@@ -74,5 +91,19 @@ func NewMessageResponse(message *model.Message) MessageResponse {
 type MessageResponse struct {
 	SenderId  string `json:"sender_id"`
 	Message   string `json:"message"`
+	Seq       uint64 `json:"seq"`
 	Timestamp int64  `json:"ts"`
 }
+
+func NewPushMessageOutput(userIds []string, message *MessageOutput) PushMessageOutput {
+	return PushMessageOutput{
+		UserIds: userIds,
+		Message: *message,
+	}
+}
+
+// PushMessageOutput Used as push webhook's body, UserIds are the users that should be notified
+type PushMessageOutput struct {
+	UserIds []string      `json:"user_ids"`
+	Message MessageOutput `json:"message"`
+}
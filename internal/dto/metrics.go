@@ -0,0 +1,21 @@
+package dto
+
+import "chatto/internal/model"
+
+func NewOutboundMetricsResponse(metrics *model.OutboundMetrics) OutboundMetricsResponse {
+	return OutboundMetricsResponse{
+		Clients:          metrics.Clients,
+		QueueDepth:       metrics.QueueDepth,
+		MaxQueueDepth:    metrics.MaxQueueDepth,
+		Dropped:          metrics.Dropped,
+		SlowDisconnected: metrics.SlowDisconnected,
+	}
+}
+
+type OutboundMetricsResponse struct {
+	Clients          int    `json:"clients"`
+	QueueDepth       int    `json:"queue_depth"`
+	MaxQueueDepth    int    `json:"max_queue_depth"`
+	Dropped          uint64 `json:"dropped"`
+	SlowDisconnected uint64 `json:"slow_disconnected"`
+}
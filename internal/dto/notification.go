@@ -30,7 +30,7 @@ func NewNotificationFromInput(userId string, input *NotificationInput) model.Not
 		Id:   uuid.NewString(),
 		Type: input.Type,
 		//Message:   model.GetNotificationMessage(sender, input.Type),
-		Timestamp:  time.Now().Unix(),
+		Timestamp:  time.Now().UnixMilli(),
 		SenderId:   userId,
 		ReceiverId: input.ReceiverId,
 	}
@@ -42,6 +42,7 @@ type NotificationInput struct {
 	ReceiverId string `json:"room_id"`
 }
 
+// NotificationRequest Used to get the room notifications, the time range is in unix milliseconds
 type NotificationRequest struct {
 	RoomId   string `json:"room_id"`
 	FromTime int64  `json:"from_time"`
@@ -64,4 +65,5 @@ type NotificationResponse struct {
 
 type TypingInput struct {
 	RoomId string `json:"room_id"`
+	Stop   bool   `json:"stop"` // Set when the user stops typing, otherwise it will start or refresh the typing state
 }
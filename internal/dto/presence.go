@@ -0,0 +1,41 @@
+package dto
+
+import (
+	"chatto/internal/model"
+)
+
+// SetPresenceInput Used to change sender's presence, ExpiresAt is unix time when the status text is removed and 0 will keep it
+type SetPresenceInput struct {
+	Status     model.PresenceStatus `json:"status"`
+	StatusText string               `json:"status_text"`
+	ExpiresAt  int64                `json:"expires_at"`
+}
+
+type GetPresenceInput struct {
+	UserIds []string `json:"user_ids"`
+}
+
+// PresenceSubscriptionInput Used to subscribe or unsubscribe presence changes of the users
+type PresenceSubscriptionInput struct {
+	UserIds []string `json:"user_ids"`
+}
+
+func NewPresenceResponse(presence *model.Presence) PresenceResponse {
+	return PresenceResponse{
+		UserId:     presence.UserId,
+		Status:     presence.Status,
+		StatusText: presence.StatusText,
+		ExpiresAt:  presence.StatusExpiry,
+		LastSeen:   presence.LastSeen,
+		Idle:       presence.Idle,
+	}
+}
+
+type PresenceResponse struct {
+	UserId     string               `json:"user_id"`
+	Status     model.PresenceStatus `json:"status"`
+	StatusText string               `json:"status_text"`
+	ExpiresAt  int64                `json:"expires_at"`
+	LastSeen   int64                `json:"last_seen"`
+	Idle       bool                 `json:"idle"` // Set when the user is away due to inactivity
+}
@@ -3,17 +3,21 @@ package dto
 import (
 	"time"
 
+	"chatto/internal/constant"
 	"chatto/internal/model"
 	"chatto/internal/util/containers"
+	"chatto/internal/util/strutil"
 	"github.com/google/uuid"
 )
 
 func NewCreateRoomOutput(room *model.Room) CreateRoomOutput {
 	return CreateRoomOutput{
-		Id:         room.Id,
-		Name:       room.Name,
-		InviteOnly: room.InviteOnly,
-		Private:    room.Private,
+		Id:          room.Id,
+		Name:        room.Name,
+		InviteOnly:  room.InviteOnly,
+		Private:     room.Private,
+		IsGroup:     room.IsGroup,
+		WorkspaceId: stringValue(room.WorkspaceId),
 	}
 }
 
@@ -24,17 +28,60 @@ func NewRoomFromCreateInput(room *CreateRoomInput) *model.Room {
 		Description: room.Description,
 		InviteOnly:  room.InviteOnly,
 		Private:     room.Private,
+		WorkspaceId: room.WorkspaceId,
+		IsDefault:   room.IsDefault && room.WorkspaceId != nil, // Global room could not be default room
 		CreatedAt:   time.Now(),
 	}
 }
 
+// NewDirectRoom Used to create private room for direct message, the room has no name because it is seen as the other member's name
+func NewDirectRoom(directKey string) *model.Room {
+	return &model.Room{
+		Id:        uuid.NewString(),
+		Private:   true,
+		DirectKey: &directKey,
+		CreatedAt: time.Now(),
+	}
+}
+
+// NewGroupRoom Used to create private room for group message, the room has no name until one of the members set it
+func NewGroupRoom(groupKey string) *model.Room {
+	return &model.Room{
+		Id:        uuid.NewString(),
+		Private:   true,
+		IsGroup:   true,
+		DirectKey: &groupKey,
+		CreatedAt: time.Now(),
+	}
+}
+
+// GroupRoomInput Used to open group room with the users, the sender is not included on UserIds
+type GroupRoomInput struct {
+	UserIds []string `json:"user_ids"`
+}
+
+// DirectRoomInput Used to open direct message room with the user
+type DirectRoomInput struct {
+	UserId string `json:"user_id"`
+}
+
+func NewCreateRoomOutputFromUserRoom(room *UserRoomResponse) CreateRoomOutput {
+	return CreateRoomOutput{
+		Id:      room.RoomId,
+		Name:    room.Name,
+		Private: room.Private,
+	}
+}
+
 // CreateRoomInput Used to create new room with members, it is needed due to no implicit feature to create the room when trying to join unlisted room
 type CreateRoomInput struct {
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"desc"`
 	InviteOnly  bool     `json:"invite_only"`
 	Private     bool     `json:"private"`
-	MemberIds   []string `json:"member_ids"` // Initial members. TODO: MemberIds should be on sender friends
+	MemberIds   []string `json:"member_ids"`   // Initial members. TODO: MemberIds should be on sender friends
+	WorkspaceId *string  `json:"workspace_id"` // Room will be global when it is nil
+	IsDefault   bool     `json:"default"`      // Only works for workspace's room
 }
 
 // RoomInput Used to join and leave room, room by the roomId should check the private
@@ -48,23 +95,122 @@ type MemberRoomInput struct {
 	UserIds []string `json:"user_ids"`
 }
 
+// UpdateRoomInput Used to update room's information, only non-nil fields will be changed
+type UpdateRoomInput struct {
+	RoomId      string  `json:"room_id"`
+	Name        *string `json:"name"`
+	Description *string `json:"desc"`
+	InviteOnly  *bool   `json:"invite_only"`
+	Topic       *string `json:"topic"`
+	Avatar      *string `json:"avatar"`
+}
+
+// Validate Used to check if the input will not make the room invalid
+func (u *UpdateRoomInput) Validate() bool {
+	return u.Name == nil || !strutil.IsEmpty(*u.Name)
+}
+
+// UpdateRoomFromInput Used to set all non-nil fields from UpdateRoomInput into the room
+func UpdateRoomFromInput(room *model.Room, input *UpdateRoomInput) {
+	if input.Name != nil {
+		room.Name = *input.Name
+	}
+	if input.Description != nil {
+		room.Description = *input.Description
+	}
+	if input.InviteOnly != nil {
+		room.InviteOnly = *input.InviteOnly
+	}
+	if input.Topic != nil {
+		room.Topic = *input.Topic
+	}
+	if input.Avatar != nil {
+		room.Avatar = *input.Avatar
+	}
+	room.UpdatedAt = time.Now()
+}
+
+// BrowseRoomInput Used to search public rooms by name or description, Page is started from 1
+type BrowseRoomInput struct {
+	WorkspaceId string `json:"workspace_id" form:"workspace_id"` // Empty workspace id will browse global rooms
+	Query       string `json:"query" form:"q"`
+	Page        int    `json:"page" form:"page"`
+	PageSize    int    `json:"page_size" form:"page_size"`
+}
+
+// Normalize Used to set default value for page and page size when it is out of range
+func (b *BrowseRoomInput) Normalize() {
+	if b.Page < 1 {
+		b.Page = 1
+	}
+	if b.PageSize < 1 {
+		b.PageSize = constant.ROOM_DIRECTORY_PAGE_SIZE
+	} else if b.PageSize > constant.ROOM_DIRECTORY_MAX_PAGE_SIZE {
+		b.PageSize = constant.ROOM_DIRECTORY_MAX_PAGE_SIZE
+	}
+}
+
+func (b *BrowseRoomInput) Offset() int {
+	return (b.Page - 1) * b.PageSize
+}
+
+// TransferRoomInput Used by room's owner to transfer the ownership into another member
+type TransferRoomInput struct {
+	RoomId string `json:"room_id"`
+	UserId string `json:"user_id"`
+}
+
+// MuteRoomInput Used to silence room's members for Duration seconds, zero duration will mute them until unmuted
+type MuteRoomInput struct {
+	RoomId   string   `json:"room_id"`
+	UserIds  []string `json:"user_ids"`
+	Duration int64    `json:"duration"`
+}
+
+// RoomSettingsInput Used to change room's moderation settings, SlowMode is in seconds and zero will disable it
+type RoomSettingsInput struct {
+	RoomId   string `json:"room_id"`
+	SlowMode int64  `json:"slow_mode"`
+}
+
 func NewChatRoomFromOutput(roomOutput *CreateRoomOutput, members ...*model.Client) *model.ChatRoom {
-	var room model.ChatRoom
+	var room *model.ChatRoom
 	if roomOutput.Private {
 		room = model.NewPrivateChatRoom(roomOutput.Id, roomOutput.Name, "", roomOutput.InviteOnly)
 	} else {
 		room = model.NewChatRoom(roomOutput.Id, roomOutput.Name, "", roomOutput.InviteOnly)
 	}
+	metadata := room.Metadata()
+	metadata.IsGroup = roomOutput.Private && roomOutput.IsGroup
+	metadata.WorkspaceId = roomOutput.WorkspaceId
+	room.SetMetadata(metadata)
 
 	room.AddClientsWithSameRole(model.RoomRoleUser, members...)
-	return &room
+	return room
+}
+
+// UpdateChatRoom Used to keep the ChatRoom information same with the stored room
+func UpdateChatRoom(chatRoom *model.ChatRoom, room *RoomResponse) {
+	chatRoom.SetMetadata(model.RoomMetadata{
+		Name:        room.Name,
+		Description: room.Description,
+		InviteOnly:  room.InviteOnly,
+		Topic:       room.Topic,
+		Avatar:      room.Avatar,
+		OwnerId:     room.OwnerId,
+		Archived:    room.Archived,
+		IsGroup:     room.IsGroup,
+		WorkspaceId: room.WorkspaceId,
+	})
 }
 
 type CreateRoomOutput struct {
-	Id         string `json:"id"`
-	Name       string `json:"name"`
-	InviteOnly bool   `json:"invite_only"`
-	Private    bool   `json:"private"`
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	InviteOnly  bool   `json:"invite_only"`
+	Private     bool   `json:"private"`
+	IsGroup     bool   `json:"group"`
+	WorkspaceId string `json:"workspace_id"`
 }
 
 func NewUserRoomOutput(userResponses []model.UserRoom) UserRoomOutput {
@@ -88,6 +234,13 @@ func NewRoomResponse(room *model.Room) RoomResponse {
 		Description: room.Description,
 		InviteOnly:  room.InviteOnly,
 		Private:     room.Private,
+		Topic:       room.Topic,
+		Avatar:      room.Avatar,
+		OwnerId:     room.OwnerId,
+		Archived:    room.Archived,
+		IsGroup:     room.IsGroup,
+		WorkspaceId: stringValue(room.WorkspaceId),
+		IsDefault:   room.IsDefault,
 	}
 }
 
@@ -97,4 +250,46 @@ type RoomResponse struct {
 	Description string `json:"desc"`
 	InviteOnly  bool   `json:"invite_only"`
 	Private     bool   `json:"private"`
+	Topic       string `json:"topic"`
+	Avatar      string `json:"avatar"`
+	OwnerId     string `json:"owner_id"`
+	Archived    bool   `json:"archived"`
+	IsGroup     bool   `json:"group"`
+	WorkspaceId string `json:"workspace_id"`
+	IsDefault   bool   `json:"default"`
+}
+
+func NewRoomDirectoryResponse(room *model.Room) RoomDirectoryResponse {
+	return RoomDirectoryResponse{
+		Id:          room.Id,
+		Name:        room.Name,
+		Description: room.Description,
+		Topic:       room.Topic,
+		Avatar:      room.Avatar,
+	}
+}
+
+type RoomDirectoryResponse struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"desc"`
+	Topic       string `json:"topic"`
+	Avatar      string `json:"avatar"`
+	MemberCount int64  `json:"member_count"`
+	OnlineCount int    `json:"online_count"`
+}
+
+type BrowseRoomOutput struct {
+	Rooms    []RoomDirectoryResponse `json:"rooms"`
+	Total    int64                   `json:"total"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"page_size"`
+}
+
+// stringValue Used to get the value of nullable string, nil will be treated as empty string
+func stringValue(str *string) string {
+	if str == nil {
+		return ""
+	}
+	return *str
 }
@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"time"
+
 	"chatto/internal/model"
 )
 
@@ -34,14 +36,154 @@ type UserRoomRemoveInput struct {
 	RoomId  string   `json:"room_id"`
 }
 
-func NewUserRoomResponse(room *model.UserRoom) UserRoomResponse {
+func NewUserRoomResponse(room *model.UserRoomDetail) UserRoomResponse {
+	return UserRoomResponse{
+		RoomId:      room.RoomId,
+		UserRole:    room.UserRole,
+		Name:        room.Name,
+		Private:     room.Private,
+		IsGroup:     room.IsGroup,
+		Archived:    room.Archived,
+		Favourite:   room.Favourite,
+		Folder:      room.Folder,
+		Position:    room.Position,
+		NotifLevel:  room.NotifLevel,
+		SnoozeUntil: unixTime(room.SnoozeUntil),
+	}
+}
+
+// NewDirectRoomResponse Used to create UserRoomResponse for private room, name is the other member's name
+func NewDirectRoomResponse(roomId string, name string) UserRoomResponse {
+	return UserRoomResponse{
+		RoomId:     roomId,
+		UserRole:   model.RoomRoleAdmin,
+		Name:       name,
+		Private:    true,
+		NotifLevel: model.NotifLevelAll,
+	}
+}
+
+// NewGroupRoomResponse Used to create user room response for group room's members, there is no admin on group room
+func NewGroupRoomResponse(roomId string, name string) UserRoomResponse {
 	return UserRoomResponse{
-		RoomId:   room.RoomId,
-		UserRole: room.UserRole,
+		RoomId:     roomId,
+		UserRole:   model.RoomRoleUser,
+		Name:       name,
+		Private:    true,
+		IsGroup:    true,
+		NotifLevel: model.NotifLevelAll,
 	}
 }
 
 type UserRoomResponse struct {
-	RoomId   string         `json:"room_id"`
-	UserRole model.RoomRole `json:"user_role"`
+	RoomId      string           `json:"room_id"`
+	UserRole    model.RoomRole   `json:"user_role"`
+	Name        string           `json:"name"`
+	Private     bool             `json:"private"`
+	IsGroup     bool             `json:"group"`
+	Archived    bool             `json:"archived"` // Archived room is read-only
+	Favourite   bool             `json:"favourite"`
+	Folder      string           `json:"folder"`
+	Position    int              `json:"position"`
+	NotifLevel  model.NotifLevel `json:"notif_level"`
+	SnoozeUntil *int64           `json:"snooze_until"` // Unix time in seconds, nil when the room is not snoozed
+}
+
+// RoomPreferenceInput Used to change user's preferences of the room, only non-nil fields will be changed
+type RoomPreferenceInput struct {
+	RoomId      string            `json:"room_id"`
+	Favourite   *bool             `json:"favourite"`
+	Folder      *string           `json:"folder"`
+	Position    *int              `json:"position"`
+	NotifLevel  *model.NotifLevel `json:"notif_level"`
+	SnoozeUntil *int64            `json:"snooze_until"` // Unix time in seconds, 0 will remove the snooze
+}
+
+// Validate Used to check if the input will not make the preference invalid
+func (r *RoomPreferenceInput) Validate() bool {
+	return r.NotifLevel == nil || model.IsValidNotifLevel(*r.NotifLevel)
+}
+
+// UpdateUserRoomFromPreference Used to set all non-nil fields from RoomPreferenceInput into the user room
+func UpdateUserRoomFromPreference(userRoom *model.UserRoom, input *RoomPreferenceInput) {
+	if input.Favourite != nil {
+		userRoom.Favourite = *input.Favourite
+	}
+	if input.Folder != nil {
+		userRoom.Folder = *input.Folder
+	}
+	if input.Position != nil {
+		userRoom.Position = *input.Position
+	}
+	if input.NotifLevel != nil {
+		userRoom.NotifLevel = *input.NotifLevel
+	}
+	if input.SnoozeUntil != nil {
+		if *input.SnoozeUntil == 0 {
+			userRoom.SnoozeUntil = nil
+		} else {
+			snoozeUntil := time.Unix(*input.SnoozeUntil, 0)
+			userRoom.SnoozeUntil = &snoozeUntil
+		}
+	}
+}
+
+// ReorderRoomsInput Used to set user's room order, the position of each room follows its index
+type ReorderRoomsInput struct {
+	RoomIds []string `json:"room_ids"`
+}
+
+func NewRoomPreferenceResponse(userRoom *model.UserRoom) RoomPreferenceResponse {
+	return RoomPreferenceResponse{
+		RoomId:      userRoom.RoomId,
+		Favourite:   userRoom.Favourite,
+		Folder:      userRoom.Folder,
+		Position:    userRoom.Position,
+		NotifLevel:  userRoom.NotifLevel,
+		SnoozeUntil: unixTime(userRoom.SnoozeUntil),
+	}
+}
+
+type RoomPreferenceResponse struct {
+	RoomId      string           `json:"room_id"`
+	Favourite   bool             `json:"favourite"`
+	Folder      string           `json:"folder"`
+	Position    int              `json:"position"`
+	NotifLevel  model.NotifLevel `json:"notif_level"`
+	SnoozeUntil *int64           `json:"snooze_until"`
+}
+
+// unixTime Used to convert nullable time into nullable unix time in seconds
+func unixTime(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	unix := t.Unix()
+	return &unix
+}
+
+// NewUserRoomsOutput Used to separate user's rooms into normal, direct and group rooms
+func NewUserRoomsOutput(rooms []UserRoomResponse) UserRoomsOutput {
+	output := UserRoomsOutput{
+		Rooms:   make([]UserRoomResponse, 0, len(rooms)),
+		Directs: make([]UserRoomResponse, 0),
+		Groups:  make([]UserRoomResponse, 0),
+	}
+	for _, room := range rooms {
+		switch {
+		case room.IsGroup:
+			output.Groups = append(output.Groups, room)
+		case room.Private:
+			output.Directs = append(output.Directs, room)
+		default:
+			output.Rooms = append(output.Rooms, room)
+		}
+	}
+	return output
+}
+
+type UserRoomsOutput struct {
+	Rooms   []UserRoomResponse `json:"rooms"`
+	Directs []UserRoomResponse `json:"directs"`
+	Groups  []UserRoomResponse `json:"groups"`
 }
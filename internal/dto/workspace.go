@@ -0,0 +1,99 @@
+package dto
+
+import (
+	"time"
+
+	"chatto/internal/model"
+	"chatto/internal/util/strutil"
+	"github.com/google/uuid"
+)
+
+func NewWorkspaceFromCreateInput(input *CreateWorkspaceInput, ownerId string) *model.Workspace {
+	return &model.Workspace{
+		Id:          uuid.NewString(),
+		Name:        input.Name,
+		Description: input.Description,
+		OwnerId:     ownerId,
+		CreatedAt:   time.Now(),
+	}
+}
+
+type CreateWorkspaceInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"desc"`
+}
+
+// UpdateWorkspaceInput Used to update workspace's information, only non-nil fields will be changed
+type UpdateWorkspaceInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"desc"`
+}
+
+// Validate Used to check if the input will not make the workspace invalid
+func (u *UpdateWorkspaceInput) Validate() bool {
+	return u.Name == nil || !strutil.IsEmpty(*u.Name)
+}
+
+// UpdateWorkspaceFromInput Used to set all non-nil fields from UpdateWorkspaceInput into the workspace
+func UpdateWorkspaceFromInput(workspace *model.Workspace, input *UpdateWorkspaceInput) {
+	if input.Name != nil {
+		workspace.Name = *input.Name
+	}
+	if input.Description != nil {
+		workspace.Description = *input.Description
+	}
+	workspace.UpdatedAt = time.Now()
+}
+
+// WorkspaceInput Used to leave the workspace
+type WorkspaceInput struct {
+	WorkspaceId string `json:"workspace_id"`
+}
+
+// WorkspaceMemberInput Used to add users into the workspace, empty role will be treated as member
+type WorkspaceMemberInput struct {
+	WorkspaceId string              `json:"workspace_id"`
+	UserIds     []string            `json:"user_ids"`
+	Role        model.WorkspaceRole `json:"role"`
+}
+
+func NewWorkspaceResponse(workspace *model.Workspace) WorkspaceResponse {
+	return WorkspaceResponse{
+		Id:          workspace.Id,
+		Name:        workspace.Name,
+		Description: workspace.Description,
+		OwnerId:     workspace.OwnerId,
+	}
+}
+
+type WorkspaceResponse struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"desc"`
+	OwnerId     string `json:"owner_id"`
+}
+
+func NewUserWorkspaceResponse(workspace *model.WorkspaceDetail) UserWorkspaceResponse {
+	return UserWorkspaceResponse{
+		WorkspaceResponse: NewWorkspaceResponse(&workspace.Workspace),
+		Role:              workspace.Role,
+	}
+}
+
+// UserWorkspaceResponse Used to show user's workspaces with the user's role on it
+type UserWorkspaceResponse struct {
+	WorkspaceResponse
+	Role model.WorkspaceRole `json:"role"`
+}
+
+func NewWorkspaceMemberResponse(member *model.WorkspaceMember) WorkspaceMemberResponse {
+	return WorkspaceMemberResponse{
+		UserId: member.UserId,
+		Role:   member.Role,
+	}
+}
+
+type WorkspaceMemberResponse struct {
+	UserId string              `json:"user_id"`
+	Role   model.WorkspaceRole `json:"role"`
+}
@@ -1,20 +1,42 @@
 package model
 
 import (
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-func NewClient(userId string, username string, role Role, conn *websocket.Conn) Client {
-	client := Client{
+// OutboundPolicy Used to decide what to do when the client's outbound queue is full
+type OutboundPolicy string
+
+const (
+	OutboundDropOldest OutboundPolicy = "drop-oldest" // Drop the oldest queued payload
+	OutboundCoalesce   OutboundPolicy = "coalesce"    // Keep only the latest typing and presence events, other payloads work like OutboundDropOldest
+	OutboundDisconnect OutboundPolicy = "disconnect"  // Close the connection of the slow client
+)
+
+func IsValidOutboundPolicy(policy OutboundPolicy) bool {
+	return policy == OutboundDropOldest || policy == OutboundCoalesce || policy == OutboundDisconnect
+}
+
+func NewClient(userId string, username string, role Role, conn *websocket.Conn, queueSize int, policy OutboundPolicy) *Client {
+	client := &Client{
 		Id:              uuid.NewString(),
 		UserId:          userId,
 		Username:        username,
 		Role:            role,
 		Conn:            conn,
-		IncomingPayload: make(chan *PayloadOutput, 100), // Make it buffered
+		Codec:           JSONCodec,
+		IncomingPayload: make(chan *PayloadOutput, queueSize), // Make it buffered
+		CoalescedReady:  make(chan struct{}, 1),
+		presenceSubs:    make(map[string]struct{}),
+		policy:          policy,
+		coalesced:       make(map[string]*PayloadOutput),
 	}
-
+	client.Touch()
 	return client
 }
 
@@ -24,10 +46,233 @@ type Client struct {
 	Username string          `json:"username"`
 	Role     Role            `json:"role"`
 	Conn     *websocket.Conn `json:"-"`
+	Codec    Codec           `json:"-"` // Negotiated by the websocket subprotocol
+
+	// SessionId Used to resume the session on reconnect, the Resume fields are set from the reconnecting client
+	SessionId       string `json:"session_id"`
+	ResumeSessionId string `json:"-"`
+	ResumeSeq       uint64 `json:"-"`
 
 	IncomingPayload chan *PayloadOutput `json:"-"`
+	// CoalescedReady Used to notify there are coalesced payloads, get them using TakeCoalesced
+	CoalescedReady chan struct{} `json:"-"`
+
+	subsMutex    sync.RWMutex
+	presenceSubs map[string]struct{} // key : userId
+
+	replaySeq atomic.Uint64 // The latest sequence written by the replay
+
+	protocol atomic.Pointer[Protocol] // Nil until the hello is received
+
+	lastActivity atomic.Int64 // Unix time in nanoseconds of the last inbound payload
+	idle         atomic.Bool  // Set when the user is marked as away due to inactivity
+
+	policy        OutboundPolicy
+	queueMutex    sync.Mutex
+	closed        bool                      // Set when the outbound queue is closed, the payloads are ignored after it
+	coalesced     map[string]*PayloadOutput // key : PayloadOutput.CoalesceKey
+	coalescedKeys []string                  // Used to keep the coalesced payloads order
+	dropped       atomic.Uint64
+	slow          atomic.Bool // Set when the client is disconnected as slow consumer
 }
 
+// SendPayload Used to queue the payload without blocking, the outbound policy is applied when the queue is full
 func (c *Client) SendPayload(payload *PayloadOutput) {
-	c.IncomingPayload <- payload
+	// Unsupported payload would be ignored by the client anyway
+	if !c.Protocol().SupportsOutput(payload) {
+		return
+	}
+
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+
+	if c.closed {
+		return
+	}
+	select {
+	case c.IncomingPayload <- payload:
+		return
+	default:
+	}
+
+	if c.policy == OutboundDisconnect {
+		c.dropped.Add(1)
+		c.disconnectSlowConsumer()
+		return
+	}
+	if c.policy == OutboundCoalesce && len(payload.CoalesceKey) != 0 {
+		c.coalesce(payload)
+		return
+	}
+
+	// Drop the oldest payloads until there is a room for the payload
+	for {
+		select {
+		case c.IncomingPayload <- payload:
+			return
+		default:
+		}
+		select {
+		case <-c.IncomingPayload:
+			c.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// CloseOutbound Used to close the outbound queue once, the write handle will write the queued payloads before closing the connection
+func (c *Client) CloseOutbound() {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.IncomingPayload)
+}
+
+// TakeCoalesced Used to get and clear all the coalesced payloads
+func (c *Client) TakeCoalesced() []*PayloadOutput {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+
+	payloads := make([]*PayloadOutput, 0, len(c.coalescedKeys))
+	for _, key := range c.coalescedKeys {
+		payloads = append(payloads, c.coalesced[key])
+	}
+	c.coalesced = make(map[string]*PayloadOutput)
+	c.coalescedKeys = nil
+	return payloads
+}
+
+// QueueDepth Used to get the number of payloads waiting to be sent
+func (c *Client) QueueDepth() int {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+	return len(c.IncomingPayload) + len(c.coalescedKeys)
+}
+
+// DroppedCount Used to get the number of payloads dropped or replaced by the outbound policy
+func (c *Client) DroppedCount() uint64 {
+	return c.dropped.Load()
+}
+
+func (c *Client) IsSlowConsumer() bool {
+	return c.slow.Load()
+}
+
+// coalesce Used to replace the coalesced payload with the same key, it should be called with queueMutex locked
+func (c *Client) coalesce(payload *PayloadOutput) {
+	if _, exist := c.coalesced[payload.CoalesceKey]; exist {
+		c.dropped.Add(1)
+	} else {
+		c.coalescedKeys = append(c.coalescedKeys, payload.CoalesceKey)
+	}
+	c.coalesced[payload.CoalesceKey] = payload
+
+	select {
+	case c.CoalescedReady <- struct{}{}:
+	default:
+	}
+}
+
+// disconnectSlowConsumer Used to close the connection once, the read handle will unregister the client
+func (c *Client) disconnectSlowConsumer() {
+	if c.Conn == nil || !c.slow.CompareAndSwap(false, true) {
+		return
+	}
+
+	conn := c.Conn
+	go func() {
+		message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer")
+		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		_ = conn.Close()
+	}()
+}
+
+// SetReplaySeq Used to set the latest sequence replayed into the client, all the events until the sequence are already written
+func (c *Client) SetReplaySeq(seq uint64) {
+	c.replaySeq.Store(seq)
+}
+
+// ShouldWrite Used by the write handle to skip the queued payload that is already written by the replay
+func (c *Client) ShouldWrite(payload *PayloadOutput) bool {
+	return payload.Seq == 0 || payload.Seq > c.replaySeq.Load()
+}
+
+// Protocol Used to get the negotiated protocol, the legacy protocol is used when the client doesn't send hello
+func (c *Client) Protocol() *Protocol {
+	if protocol := c.protocol.Load(); protocol != nil {
+		return protocol
+	}
+	return legacyProtocol
+}
+
+func (c *Client) SetProtocol(protocol *Protocol) {
+	c.protocol.Store(protocol)
+}
+
+// Touch Used to update the last activity time of the client into now
+func (c *Client) Touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// IsInactive Used to check if the client has no activity for the duration
+func (c *Client) IsInactive(duration time.Duration, now time.Time) bool {
+	return now.Sub(time.Unix(0, c.lastActivity.Load())) >= duration
+}
+
+// SetIdle Used to change the client's idle flag, it returns false when the flag is already the same
+func (c *Client) SetIdle(idle bool) bool {
+	return c.idle.CompareAndSwap(!idle, idle)
+}
+
+func (c *Client) IsIdle() bool {
+	return c.idle.Load()
+}
+
+// SubscribePresence Used to subscribe presence changes of the users, it returns false without subscribing when the subscriptions will exceed the limit
+func (c *Client) SubscribePresence(limit int, userIds ...string) bool {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	count := len(c.presenceSubs)
+	for _, userId := range userIds {
+		if _, exist := c.presenceSubs[userId]; !exist {
+			count++
+		}
+	}
+	if count > limit {
+		return false
+	}
+
+	for _, userId := range userIds {
+		c.presenceSubs[userId] = struct{}{}
+	}
+	return true
+}
+
+func (c *Client) UnsubscribePresence(userIds ...string) {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+	for _, userId := range userIds {
+		delete(c.presenceSubs, userId)
+	}
+}
+
+// IsPresenceSubscribed Used to check if the client subscribes presence changes of the user
+func (c *Client) IsPresenceSubscribed(userId string) bool {
+	c.subsMutex.RLock()
+	defer c.subsMutex.RUnlock()
+	_, exist := c.presenceSubs[userId]
+	return exist
+}
+
+// OutboundMetrics Used to describe the outbound queues of the connected clients
+type OutboundMetrics struct {
+	Clients          int
+	QueueDepth       int // Total queued payloads of all clients
+	MaxQueueDepth    int
+	Dropped          uint64 // Total dropped payloads including the disconnected clients
+	SlowDisconnected uint64 // Number of clients disconnected as slow consumer
 }
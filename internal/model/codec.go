@@ -0,0 +1,126 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+const (
+	SubprotocolJSON    = "chatto.json.v1"
+	SubprotocolMsgpack = "chatto.msgpack.v1"
+)
+
+// Subprotocols Used as the supported websocket subprotocols ordered by the preference
+var Subprotocols = []string{SubprotocolMsgpack, SubprotocolJSON}
+
+// Codec Used to encode and decode the websocket frames of the client, it is chosen by the negotiated subprotocol
+type Codec interface {
+	Subprotocol() string
+	// MessageType Used as the websocket message type of the encoded frame
+	MessageType() int
+	Encode(payload *PayloadOutput) ([]byte, error)
+	// Decode Used to decode the frame, the payload data is kept encoded until it is decoded by DecodeData
+	Decode(frame []byte) (PayloadInput, error)
+	DecodeData(data []byte, v any) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = newMsgpackCodec()
+)
+
+// CodecBySubprotocol Used to get the codec of the subprotocol, JSON is used when the client doesn't negotiate any subprotocol
+func CodecBySubprotocol(subprotocol string) Codec {
+	if subprotocol == SubprotocolMsgpack {
+		return MsgpackCodec
+	}
+	return JSONCodec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string {
+	return SubprotocolJSON
+}
+
+func (jsonCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) Encode(payload *PayloadOutput) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (jsonCodec) Decode(frame []byte) (PayloadInput, error) {
+	var input struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	err := json.Unmarshal(frame, &input)
+	return PayloadInput{Type: input.Type, Data: input.Data}, err
+}
+
+func (jsonCodec) DecodeData(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func newMsgpackCodec() msgpackCodec {
+	mapType := reflect.TypeOf(map[string]any(nil))
+
+	handle := &codec.MsgpackHandle{}
+	handle.WriteExt = true // Use str and bin types of the new spec
+	handle.MapType = mapType
+
+	// Used to convert the raw JSON data from Redis or the other nodes
+	jsonHandle := &codec.JsonHandle{}
+	jsonHandle.MapType = mapType
+
+	return msgpackCodec{handle: handle, jsonHandle: jsonHandle}
+}
+
+// msgpackCodec Used to encode the payload as MessagePack, the fields follow the json tags
+type msgpackCodec struct {
+	handle     *codec.MsgpackHandle
+	jsonHandle *codec.JsonHandle
+}
+
+func (m msgpackCodec) Subprotocol() string {
+	return SubprotocolMsgpack
+}
+
+func (m msgpackCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (m msgpackCodec) Encode(payload *PayloadOutput) ([]byte, error) {
+	// Raw JSON would be encoded as binary, so it is decoded first
+	if raw, ok := payload.Data.(json.RawMessage); ok {
+		var data any
+		if err := codec.NewDecoderBytes(raw, m.jsonHandle).Decode(&data); err != nil {
+			return nil, err
+		}
+		output := *payload
+		output.Data = data
+		payload = &output
+	}
+
+	var frame []byte
+	err := codec.NewEncoderBytes(&frame, m.handle).Encode(payload)
+	return frame, err
+}
+
+func (m msgpackCodec) Decode(frame []byte) (PayloadInput, error) {
+	var input struct {
+		Type string    `codec:"type"`
+		Data codec.Raw `codec:"data"`
+	}
+	err := codec.NewDecoderBytes(frame, m.handle).Decode(&input)
+	return PayloadInput{Type: input.Type, Data: input.Data}, err
+}
+
+func (m msgpackCodec) DecodeData(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, m.handle).Decode(v)
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	type messageData struct {
+		RoomId  string `json:"room_id"`
+		Content string `json:"content"`
+		Seq     int64  `json:"seq"`
+	}
+
+	tests := []struct {
+		name  string
+		codec Codec
+		data  any
+	}{
+		{
+			name:  "json struct data",
+			codec: JSONCodec,
+			data:  messageData{RoomId: "room", Content: "hello", Seq: 7},
+		},
+		{
+			name:  "json raw data",
+			codec: JSONCodec,
+			data:  json.RawMessage(`{"room_id":"room","content":"hello","seq":7}`),
+		},
+		{
+			name:  "msgpack struct data",
+			codec: MsgpackCodec,
+			data:  messageData{RoomId: "room", Content: "hello", Seq: 7},
+		},
+		{
+			name:  "msgpack raw data",
+			codec: MsgpackCodec,
+			data:  json.RawMessage(`{"room_id":"room","content":"hello","seq":7}`),
+		},
+	}
+
+	want := messageData{RoomId: "room", Content: "hello", Seq: 7}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := tt.codec.Encode(&PayloadOutput{Type: PayloadMessage, Data: tt.data})
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			input, err := tt.codec.Decode(frame)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if input.Type != PayloadMessage {
+				t.Errorf("Decode() type = %v, want %v", input.Type, PayloadMessage)
+			}
+
+			got, err := PayloadData[messageData](&Payload{Type: input.Type, Data: input.Data, Codec: tt.codec})
+			if err != nil {
+				t.Fatalf("PayloadData() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("PayloadData() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCodecBySubprotocol(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		want        string
+	}{
+		{subprotocol: SubprotocolMsgpack, want: SubprotocolMsgpack},
+		{subprotocol: SubprotocolJSON, want: SubprotocolJSON},
+		{subprotocol: "", want: SubprotocolJSON},
+		{subprotocol: "unknown", want: SubprotocolJSON},
+	}
+	for _, tt := range tests {
+		if got := CodecBySubprotocol(tt.subprotocol).Subprotocol(); got != tt.want {
+			t.Errorf("CodecBySubprotocol(%q) = %v, want %v", tt.subprotocol, got, tt.want)
+		}
+	}
+}
@@ -77,4 +77,27 @@ const (
 
 	// Chat
 	PAYLOAD_BAD_FORMAT_ERROR
+	CHAT_USER_MUTED_ERROR
+	CHAT_SLOW_MODE_ERROR
+	ROOM_OWNER_LEAVE_ERROR
+	ROOM_ARCHIVED_ERROR
+	ROOM_MEMBER_LIMIT_ERROR
+	ROOM_DUPLICATE_ERROR
+
+	// Workspace
+	WORKSPACE_NOT_FOUND_ERROR
+	WORKSPACE_NOT_MEMBER_ERROR
+	WORKSPACE_NOT_EMPTY_ERROR
+	WORKSPACE_OWNER_LEAVE_ERROR
+	WORKSPACE_ROLE_NOT_FOUND_ERROR
+
+	// Presence
+	PRESENCE_SUBSCRIPTION_LIMIT_ERROR
+
+	// Protocol
+	PROTOCOL_UNSUPPORTED_ERROR
+	PROTOCOL_UNSUPPORTED_PAYLOAD_ERROR
+
+	// Payload
+	PAYLOAD_OVERLOADED_ERROR
 )
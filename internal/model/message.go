@@ -1,5 +1,11 @@
 package model
 
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 type MessageType string
 
 type Message struct {
@@ -7,5 +13,36 @@ type Message struct {
 	SenderId   string `json:"sender_id"`
 	ReceiverId string `json:"receiver_id"`
 	Message    string `json:"message"`
-	Timestamp  int64  `json:"ts"`
+	Seq        uint64 `json:"seq"` // Sequence of the message on the room, it is assigned when the message is stored
+	Timestamp  int64  `json:"ts"`  // Unix time in milliseconds
+}
+
+// Mentions Used to check if the username is mentioned on the message by using "@username", the mention should not be followed
+// by another username character, so "@bob" doesn't match "@bobby"
+func (m *Message) Mentions(username string) bool {
+	if len(username) == 0 {
+		return false
+	}
+
+	mention := "@" + username
+	for text := m.Message; ; {
+		index := strings.Index(text, mention)
+		if index < 0 {
+			return false
+		}
+		if !continuesUsername(text[index+len(mention):]) {
+			return true
+		}
+		text = text[index+1:]
+	}
+}
+
+// continuesUsername Used to check if the text right after the mention is still part of a longer username, the dot is only
+// part of the username when it is followed by another username character, so it could end the sentence
+func continuesUsername(text string) bool {
+	next, size := utf8.DecodeRuneInString(text)
+	if next == '.' {
+		next, _ = utf8.DecodeRuneInString(text[size:])
+	}
+	return next != utf8.RuneError && (unicode.IsLetter(next) || unicode.IsDigit(next) || next == '_' || next == '-')
 }
@@ -0,0 +1,30 @@
+package model
+
+import "testing"
+
+func TestMessage_Mentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		username string
+		want     bool
+	}{
+		{name: "exact mention", message: "hi @bob", username: "bob", want: true},
+		{name: "mention followed by punctuation", message: "@bob, are you there?", username: "bob", want: true},
+		{name: "longer username", message: "hi @bobby", username: "bob", want: false},
+		{name: "longer username before exact mention", message: "@bobby and @bob", username: "bob", want: true},
+		{name: "mention ended by dot", message: "thanks @bob.", username: "bob", want: true},
+		{name: "dotted username", message: "hi @bob.smith", username: "bob", want: false},
+		{name: "username with space", message: "hi @bob smith!", username: "bob smith", want: true},
+		{name: "no mention", message: "hi bob", username: "bob", want: false},
+		{name: "empty username", message: "hi @", username: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Message: tt.message}
+			if got := m.Mentions(tt.username); got != tt.want {
+				t.Errorf("Mentions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
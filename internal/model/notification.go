@@ -6,8 +6,16 @@ const (
 	NotifTyping NotificationType = iota
 	NotifJoinRoom
 	NotifLeaveRoom
+	NotifPromoteAdmin
+	NotifTransferOwner
+	NotifStopTyping
 )
 
+// IsTyping Used to check if the notification is typing state, typing notification is not stored
+func (n NotificationType) IsTyping() bool {
+	return n == NotifTyping || n == NotifStopTyping
+}
+
 func GetNotificationMessage(client *Client, types NotificationType) string {
 	message := ""
 	switch types {
@@ -15,6 +23,10 @@ func GetNotificationMessage(client *Client, types NotificationType) string {
 		message = client.Username + " joined room"
 	case NotifLeaveRoom:
 		message = client.Username + " leave room"
+	case NotifPromoteAdmin:
+		message = client.Username + " promoted as admin"
+	case NotifTransferOwner:
+		message = client.Username + " is the new owner"
 	}
 	return message
 }
@@ -25,5 +37,5 @@ type Notification struct {
 	//Message   string           `json:"message"`
 	SenderId   string `json:"sender_id"`
 	ReceiverId string `json:"receiver_id"`
-	Timestamp  int64  `json:"ts"`
+	Timestamp  int64  `json:"ts"` // Unix time in milliseconds
 }
@@ -1,24 +1,46 @@
 package model
 
-import (
-	"encoding/json"
-)
-
 const (
-	PayloadTyping           = "typing"
-	PayloadMessage          = "chat"
-	PayloadNotification     = "notif"
-	PayloadCreateRoom       = "create-room"
-	PayloadJoinRoom         = "join-room"
-	PayloadLeaveRoom        = "leave-room"
-	PayloadInviteToRoom     = "invite-room"
-	PayloadKickFromRoom     = "kick-room"
-	PayloadGetUsers         = "get-users"
-	PayloadGetChats         = "get-chats"
-	PayloadGetNotifications = "get-notifs"
-	PayloadGetUserRooms     = "user-rooms"
-	PayloadErrorResponse    = "error"
-	PayloadSuccessResponse  = "success"
+	PayloadTyping                = "typing"
+	PayloadMessage               = "chat"
+	PayloadNotification          = "notif"
+	PayloadCreateRoom            = "create-room"
+	PayloadOpenDirectRoom        = "open-dm"
+	PayloadOpenGroupRoom         = "open-group"
+	PayloadJoinRoom              = "join-room"
+	PayloadLeaveRoom             = "leave-room"
+	PayloadInviteToRoom          = "invite-room"
+	PayloadKickFromRoom          = "kick-room"
+	PayloadMuteUser              = "mute-room"
+	PayloadUnmuteUser            = "unmute-room"
+	PayloadRoomSettings          = "room-settings"
+	PayloadUpdateRoom            = "update-room"
+	PayloadRoomUpdated           = "room-updated"
+	PayloadTransferRoom          = "transfer-room"
+	PayloadBrowseRooms           = "browse-rooms"
+	PayloadArchiveRoom           = "archive-room"
+	PayloadRestoreRoom           = "restore-room"
+	PayloadGetUsers              = "get-users"
+	PayloadGetChats              = "get-chats"
+	PayloadGetNotifications      = "get-notifs"
+	PayloadGetUserRooms          = "user-rooms"
+	PayloadRoomPreference        = "room-prefs"
+	PayloadReorderRooms          = "reorder-rooms"
+	PayloadRoomPreferenceUpdated = "room-prefs-updated"
+	PayloadSetPresence           = "set-presence"
+	PayloadGetPresence           = "get-presence"
+	PayloadPresence              = "presence"
+	PayloadSubscribePresence     = "subscribe-presence"
+	PayloadUnsubscribePresence   = "unsubscribe-presence"
+	PayloadInviteWorkspace       = "invite-workspace"
+	PayloadLeaveWorkspace        = "leave-workspace"
+	PayloadWorkspaceAdded        = "workspace-added"
+	PayloadGetWorkspaces         = "user-workspaces"
+	PayloadGoingAway             = "going-away"
+	PayloadSession               = "session"
+	PayloadHello                 = "hello"
+	PayloadErrorResponse         = "error"
+	PayloadSuccessResponse       = "success"
 )
 
 func NewErrorPayloadOutput(code uint, message string) PayloadOutput {
@@ -42,26 +64,33 @@ func NewPayloadOutput[T any](types string, data *T) PayloadOutput {
 	return output
 }
 
+// Payload Used to handle the client's payload, the data is still encoded by the codec until PayloadData is called
 type Payload struct {
-	Type string
-	Data any
+	Type  string
+	Data  []byte
+	Codec Codec // JSONCodec is used when it is nil
 
 	Sender *Client
 }
 
+// PayloadInput Used as the decoded frame, the data is kept encoded
 type PayloadInput struct {
-	Type string `json:"type"`
-	Data any    `json:"data"`
+	Type string
+	Data []byte
 }
 
+// PayloadData Used to decode the payload data directly into T, empty data will return zero value of T
 func PayloadData[T any](payload *Payload) (T, error) {
 	var t T
-	bytes, err := json.Marshal(payload.Data)
-	if err != nil {
-		return t, err
+	if len(payload.Data) == 0 {
+		return t, nil
 	}
 
-	err = json.Unmarshal(bytes, &t)
+	codec := payload.Codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	err := codec.DecodeData(payload.Data, &t)
 	return t, err
 }
 
@@ -73,4 +102,30 @@ type ErrorPayload struct {
 type PayloadOutput struct {
 	Type string `json:"type"`
 	Data any    `json:"data,omitempty"`
+
+	// Seq Used as the user's event sequence, zero when the payload is not recorded
+	Seq uint64 `json:"seq,omitempty"`
+
+	// CoalesceKey Used to replace queued payload with the same key when the client is slow, empty key is never coalesced
+	CoalesceKey string `json:"-"`
+	// Feature Used as the feature needed by the client to receive the payload, empty feature is sent into all the clients
+	Feature string `json:"-"`
+}
+
+// IsReplayable Used to check if the payload should be recorded for replay, the coalesced payloads like typing and presence are only sent to the connected clients
+func (p *PayloadOutput) IsReplayable() bool {
+	return len(p.CoalesceKey) == 0
 }
+
+// WithSeq Used to get copy of the payload with the sequence, zero sequence will return the payload itself
+func (p *PayloadOutput) WithSeq(seq uint64) *PayloadOutput {
+	if seq == 0 {
+		return p
+	}
+	output := *p
+	output.Seq = seq
+	return &output
+}
+
+// EventRecorder Used to give the payload a sequence for each user and keep it for replay, it returns the sequence of each recorded user
+type EventRecorder func(payload *PayloadOutput, userIds []string) map[string]uint64
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceOnline    PresenceStatus = "online"
+	PresenceAway      PresenceStatus = "away"
+	PresenceBusy      PresenceStatus = "busy"
+	PresenceInvisible PresenceStatus = "invisible"
+	PresenceOffline   PresenceStatus = "offline" // Only used for users without connected client, it could not be set by the user
+)
+
+// IsValidPresenceStatus Used to check if the status could be set by the user
+func IsValidPresenceStatus(status PresenceStatus) bool {
+	return status == PresenceOnline || status == PresenceAway || status == PresenceBusy || status == PresenceInvisible
+}
+
+type Presence struct {
+	UserId       string
+	Status       PresenceStatus
+	StatusText   string
+	StatusExpiry int64 // Unix time when the status text is expired, 0 means it never expires
+	LastSeen     int64 // Unix time when the last client of the user disconnected
+	Online       int64 // Number of connected clients
+	Idle         bool  // Set when all the clients are inactive, online user will be seen as away
+}
+
+// Public Used to get the presence as seen by the other users, invisible and disconnected users are seen as offline and idle online users are seen as away.
+// Offline users are never seen as idle, so the invisible users don't leak that they are connected
+func (p Presence) Public(now time.Time) Presence {
+	if p.StatusExpiry != 0 && now.Unix() >= p.StatusExpiry {
+		p.StatusText = ""
+		p.StatusExpiry = 0
+	}
+	if p.Online <= 0 || p.Status == PresenceInvisible {
+		p.Status = PresenceOffline
+		p.Idle = false
+	} else if p.Status == "" || p.Status == PresenceOnline {
+		p.Status = PresenceOnline
+		if p.Idle {
+			p.Status = PresenceAway
+		}
+	}
+	return p
+}
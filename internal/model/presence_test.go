@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresence_Public(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		presence   Presence
+		wantStatus PresenceStatus
+		wantIdle   bool
+	}{
+		{
+			name:       "idle online user is away",
+			presence:   Presence{Status: PresenceOnline, Online: 1, Idle: true},
+			wantStatus: PresenceAway,
+			wantIdle:   true,
+		},
+		{
+			name:       "idle invisible user is offline",
+			presence:   Presence{Status: PresenceInvisible, Online: 1, Idle: true},
+			wantStatus: PresenceOffline,
+			wantIdle:   false,
+		},
+		{
+			name:       "disconnected user is offline",
+			presence:   Presence{Status: PresenceBusy, Online: 0, Idle: true},
+			wantStatus: PresenceOffline,
+			wantIdle:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.presence.Public(now)
+			if got.Status != tt.wantStatus {
+				t.Errorf("Public() status = %v, want %v", got.Status, tt.wantStatus)
+			}
+			if got.Idle != tt.wantIdle {
+				t.Errorf("Public() idle = %v, want %v", got.Idle, tt.wantIdle)
+			}
+		})
+	}
+}
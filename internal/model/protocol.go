@@ -0,0 +1,107 @@
+package model
+
+const (
+	// ProtocolVersionLegacy Used as the version of the clients that don't send hello, all the features are enabled for them
+	ProtocolVersionLegacy = 1
+	// ProtocolVersionHello Used as the version that the hello handshake is introduced
+	ProtocolVersionHello = 2
+
+	// ProtocolVersionMin Used as the oldest version still supported by the server
+	ProtocolVersionMin = ProtocolVersionLegacy
+	// ProtocolVersion Used as the latest version supported by the server
+	ProtocolVersion = ProtocolVersionHello
+)
+
+const (
+	FeatureTyping   = "typing"
+	FeaturePresence = "presence"
+)
+
+// ServerFeatures Used as the features supported by the server, the other feature flags sent by the client are ignored
+var ServerFeatures = []string{FeatureTyping, FeaturePresence}
+
+// payloadVersions Used as the minimum protocol version of the inbound payload, the payload that is not listed is supported since ProtocolVersionLegacy
+var payloadVersions = map[string]int{
+	PayloadHello: ProtocolVersionHello,
+}
+
+// payloadFeatures Used as the feature needed by the inbound payload
+var payloadFeatures = map[string]string{
+	PayloadTyping:              FeatureTyping,
+	PayloadSetPresence:         FeaturePresence,
+	PayloadGetPresence:         FeaturePresence,
+	PayloadSubscribePresence:   FeaturePresence,
+	PayloadUnsubscribePresence: FeaturePresence,
+}
+
+// legacyProtocol Used as the protocol of the client until the hello is received
+var legacyProtocol = &Protocol{Version: ProtocolVersionLegacy}
+
+// NegotiateProtocol Used to get the protocol supported by both the client and the server, the version is downgraded into ProtocolVersion
+// when the client is newer. It returns false when the client is older than ProtocolVersionMin
+func NegotiateProtocol(version int, clientName string, clientVersion string, features []string) (*Protocol, bool) {
+	if version < ProtocolVersionMin {
+		return nil, false
+	}
+
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	protocol := &Protocol{
+		Version:       version,
+		ClientName:    clientName,
+		ClientVersion: clientVersion,
+		features:      make(map[string]struct{}),
+	}
+	for _, feature := range features {
+		for _, supported := range ServerFeatures {
+			if feature == supported {
+				protocol.features[feature] = struct{}{}
+			}
+		}
+	}
+	return protocol, true
+}
+
+// Protocol Used as the negotiated protocol of the client
+type Protocol struct {
+	Version       int
+	ClientName    string
+	ClientVersion string
+
+	features map[string]struct{} // nil means all the features are enabled
+}
+
+// HasFeature Used to check if the feature is negotiated
+func (p *Protocol) HasFeature(feature string) bool {
+	if p.features == nil {
+		return true
+	}
+	_, exist := p.features[feature]
+	return exist
+}
+
+// Features Used to get the negotiated features ordered as ServerFeatures
+func (p *Protocol) Features() []string {
+	features := make([]string, 0, len(ServerFeatures))
+	for _, feature := range ServerFeatures {
+		if p.HasFeature(feature) {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// SupportsPayload Used to check if the inbound payload type could be handled for the client
+func (p *Protocol) SupportsPayload(types string) bool {
+	if version, exist := payloadVersions[types]; exist && p.Version < version {
+		return false
+	}
+	feature, exist := payloadFeatures[types]
+	return !exist || p.HasFeature(feature)
+}
+
+// SupportsOutput Used to check if the outbound payload should be sent into the client
+func (p *Protocol) SupportsOutput(payload *PayloadOutput) bool {
+	return len(payload.Feature) == 0 || p.HasFeature(payload.Feature)
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	tests := []struct {
+		name         string
+		version      int
+		features     []string
+		wantOk       bool
+		wantVersion  int
+		wantFeatures []string
+	}{
+		{
+			name:         "current version",
+			version:      ProtocolVersion,
+			features:     []string{FeaturePresence, FeatureTyping},
+			wantOk:       true,
+			wantVersion:  ProtocolVersion,
+			wantFeatures: []string{FeatureTyping, FeaturePresence},
+		},
+		{
+			name:         "newer client is downgraded",
+			version:      ProtocolVersion + 1,
+			features:     []string{FeatureTyping},
+			wantOk:       true,
+			wantVersion:  ProtocolVersion,
+			wantFeatures: []string{FeatureTyping},
+		},
+		{
+			name:         "unknown features are ignored",
+			version:      ProtocolVersion,
+			features:     []string{"reactions", "threads"},
+			wantOk:       true,
+			wantVersion:  ProtocolVersion,
+			wantFeatures: []string{},
+		},
+		{
+			name:    "older than minimum version",
+			version: ProtocolVersionMin - 1,
+			wantOk:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, ok := NegotiateProtocol(tt.version, "client", "1.0.0", tt.features)
+			if ok != tt.wantOk {
+				t.Fatalf("NegotiateProtocol() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if protocol.Version != tt.wantVersion {
+				t.Errorf("NegotiateProtocol() version = %v, want %v", protocol.Version, tt.wantVersion)
+			}
+			if got := protocol.Features(); !reflect.DeepEqual(got, tt.wantFeatures) {
+				t.Errorf("Features() = %v, want %v", got, tt.wantFeatures)
+			}
+		})
+	}
+}
+
+func TestProtocol_Supports(t *testing.T) {
+	current, _ := NegotiateProtocol(ProtocolVersion, "client", "1.0.0", []string{FeaturePresence})
+
+	tests := []struct {
+		name     string
+		protocol *Protocol
+		types    string
+		feature  string
+		want     bool
+	}{
+		{name: "legacy has all features", protocol: legacyProtocol, types: PayloadTyping, feature: FeatureTyping, want: true},
+		{name: "legacy doesn't support newer payload", protocol: legacyProtocol, types: PayloadHello, want: false},
+		{name: "negotiated feature", protocol: current, types: PayloadSubscribePresence, feature: FeaturePresence, want: true},
+		{name: "feature not negotiated", protocol: current, types: PayloadTyping, feature: FeatureTyping, want: false},
+		{name: "payload without feature", protocol: current, types: PayloadMessage, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.protocol.SupportsPayload(tt.types); got != tt.want {
+				t.Errorf("SupportsPayload() = %v, want %v", got, tt.want)
+			}
+			if tt.types == PayloadHello {
+				return
+			}
+			if got := tt.protocol.SupportsOutput(&PayloadOutput{Type: tt.types, Feature: tt.feature}); got != tt.want {
+				t.Errorf("SupportsOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"chatto/internal/util/containers"
@@ -19,113 +22,313 @@ type Room struct {
 	Description string
 	InviteOnly  bool `gorm:"not null"` // Used for invite only
 	Private     bool `gorm:"not null"` // Used for eiter this room is private chat (2 users) or not
+	Topic       string
+	Avatar      string  // Avatar image url
+	OwnerId     string  `gorm:"not null;default:''"`    // Owner is the only one who can transfer the ownership
+	Archived    bool    `gorm:"not null;default:false"` // Archived room is read-only
+	IsGroup     bool    `gorm:"not null;default:false"` // Used for private room with more than 2 users
+	DirectKey   *string `gorm:"uniqueIndex"`            // Normalized members key for private room, used to prevent duplicated private room
+	WorkspaceId *string `gorm:"type:uuid;index"`        // Room without workspace is global
+	IsDefault   bool    `gorm:"not null;default:false"` // Default room is joined automatically when joining the workspace
 
 	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-func newChatRoom(id, name, desc string, inviteOnly, private bool) ChatRoom {
-	return ChatRoom{
-		Id:          id,
-		Name:        name,
-		Description: desc,
-		InviteOnly:  inviteOnly,
-		Private:     private,
-		clients:     make(map[string]*Client, 0),
-		roles:       make(map[string]RoomRole, 0),
+// NewDirectKey Used to create normalized key from the private room's members, the key is same regardless of the members order
+func NewDirectKey(userIds ...string) string {
+	ids := make([]string, len(userIds))
+	copy(ids, userIds)
+	sort.Strings(ids)
+	return strings.Join(ids, ":")
+}
+
+// NewGroupKey Works like NewDirectKey, but it is used for group private room
+func NewGroupKey(userIds ...string) string {
+	return "group:" + NewDirectKey(userIds...)
+}
+
+func newChatRoom(id, name, desc string, inviteOnly, private bool) *ChatRoom {
+	return &ChatRoom{
+		Id:      id,
+		Private: private,
+		metadata: RoomMetadata{
+			Name:        name,
+			Description: desc,
+			InviteOnly:  inviteOnly,
+		},
+		clients: make(map[string]*Client, 0),
+		roles:   make(map[string]RoomRole, 0),
+		members: make(map[string]struct{}),
 	}
 }
 
-func NewChatRoom(id, name, desc string, inviteOnly bool) ChatRoom {
+func NewChatRoom(id, name, desc string, inviteOnly bool) *ChatRoom {
 	return newChatRoom(id, name, desc, inviteOnly, false)
 }
 
-func NewPrivateChatRoom(id, name, desc string, inviteOnly bool) ChatRoom {
+func NewPrivateChatRoom(id, name, desc string, inviteOnly bool) *ChatRoom {
 	return newChatRoom(id, name, desc, inviteOnly, true)
 }
 
-type ChatRoom struct {
-	Id          string
+// RoomMetadata Used as the room information that could be changed while the room is used
+type RoomMetadata struct {
 	Name        string
 	Description string
 	InviteOnly  bool
-	Private     bool
-	clients     map[string]*Client  // key : clientId
-	roles       map[string]RoomRole // key : userId
+	Topic       string
+	Avatar      string
+	OwnerId     string
+	Archived    bool
+	IsGroup     bool
+	WorkspaceId string
+}
+
+// ChatRoom Used to keep the connected clients of the room, the members and the metadata are safe to be accessed from multiple goroutines
+type ChatRoom struct {
+	Id      string
+	Private bool
+
+	membersMutex sync.RWMutex
+	metadata     RoomMetadata
+	clients      map[string]*Client  // key : clientId
+	roles        map[string]RoomRole // key : userId
+	members      map[string]struct{} // key : userId, all members including the disconnected users
+
+	publisher RoomPublisher // Used to send the broadcast into the other nodes, nil on single node
+	recorder  EventRecorder // Used to keep the broadcast for the members replay, nil when the events are not recorded
+}
+
+// RoomBroadcast Used to describe a broadcast so it could be delivered on the other nodes
+type RoomBroadcast struct {
+	RoomId           string
+	Payload          *PayloadOutput
+	ExcludeClientIds []string
+	ExcludeUserId    string
+	Seqs             map[string]uint64 // Event sequence of each member, key : userId
+}
+
+type RoomPublisher func(broadcast *RoomBroadcast)
+
+// SetPublisher Used to publish every broadcast of the room, it should be set before the room is used
+func (r *ChatRoom) SetPublisher(publisher RoomPublisher) {
+	r.publisher = publisher
+}
+
+// SetRecorder Used to record every replayable broadcast for the members, it should be set before the room is used
+func (r *ChatRoom) SetRecorder(recorder EventRecorder) {
+	r.recorder = recorder
+}
+
+// Metadata Used to get snapshot of the room information, changes on the room will not affect the returned value
+func (r *ChatRoom) Metadata() RoomMetadata {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
+	return r.metadata
+}
+
+// SetMetadata Used to replace all the room information at once
+func (r *ChatRoom) SetMetadata(metadata RoomMetadata) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	r.metadata = metadata
+}
+
+// SetOwner Used to change the room's owner, empty userId means the room has no owner
+func (r *ChatRoom) SetOwner(userId string) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	r.metadata.OwnerId = userId
+}
+
+// ReleaseOwner Used to remove the owner only when the user is still the room's owner
+func (r *ChatRoom) ReleaseOwner(userId string) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	if r.metadata.OwnerId == userId {
+		r.metadata.OwnerId = ""
+	}
+}
+
+// SetMembers Used to replace all members of the room, the connected clients are not changed
+func (r *ChatRoom) SetMembers(userIds ...string) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	r.members = make(map[string]struct{}, len(userIds))
+	for _, userId := range userIds {
+		r.members[userId] = struct{}{}
+	}
+}
+
+// AddMembers Used to add the users as members although they don't have any connected client
+func (r *ChatRoom) AddMembers(userIds ...string) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	for _, userId := range userIds {
+		r.members[userId] = struct{}{}
+	}
+}
+
+// MemberIds Used to get all members including the disconnected users
+func (r *ChatRoom) MemberIds() []string {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
+	return containers.MapKeys(r.members)
 }
 
 // IsClientExist Used to check single client if it is already on the room
 func (r *ChatRoom) IsClientExist(client *Client) bool {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
 	return r.clients[client.Id] != nil
 }
 
 func (r *ChatRoom) GetRoleByUserId(userId string) (RoomRole, bool) {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
 	role, exist := r.roles[userId]
 	return role, exist
 }
 
+// SetRole Used to change the role of user that is already on the room
+func (r *ChatRoom) SetRole(userId string, role RoomRole) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	if _, exist := r.roles[userId]; exist {
+		r.roles[userId] = role
+	}
+}
+
 // IsUserExist Used to check if the user is already on the room
 func (r *ChatRoom) IsUserExist(userId string) bool {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
 	return containers.MapIsExist(r.clients, func(key string, val *Client) bool {
 		return val.UserId == userId
 	})
 }
 
+// Clients Used to get snapshot of the connected clients, changes on the room will not affect the returned slice
 func (r *ChatRoom) Clients() []*Client {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
 	return containers.MapValues(r.clients)
 }
 
+// OnlineCount Used to get the number of users that have connected client on the room
+func (r *ChatRoom) OnlineCount() int {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
+	return len(r.roles)
+}
+
 func (r *ChatRoom) UserIds() []string {
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
 	return containers.MapKeys(r.roles)
 }
 
 func (r *ChatRoom) AddClient(client *Client, role RoomRole) {
-	r.clients[client.Id] = client
-	_, exist := r.roles[client.UserId]
-	if !exist {
-		r.roles[client.UserId] = role
-	}
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
+	r.addClient(client, role)
 }
 
 func (r *ChatRoom) AddClientsWithSameRole(role RoomRole, clients ...*Client) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
 	for _, c := range clients {
-		r.AddClient(c, role)
+		r.addClient(c, role)
 	}
 }
 
 func (r *ChatRoom) RemoveClient(client *Client) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
 	delete(r.clients, client.Id)
-	if containers.IsEmpty(r.GetClientsByUserId(client.UserId)) {
+	if containers.IsEmpty(r.getClientsByUserId(client.UserId)) {
 		delete(r.roles, client.UserId)
 	}
 }
 
 func (r *ChatRoom) GetClientsByUserId(userId string) []*Client {
-	clients := make([]*Client, 0, 3)
-	for _, c := range r.clients {
-		if userId == c.UserId {
-			clients = append(clients, c)
-		}
-	}
-	return clients
+	r.membersMutex.RLock()
+	defer r.membersMutex.RUnlock()
+	return r.getClientsByUserId(userId)
 }
 
 func (r *ChatRoom) RemoveClientsByUserId(userId string) {
+	r.membersMutex.Lock()
+	defer r.membersMutex.Unlock()
 	for _, c := range r.clients {
 		if userId == c.UserId {
 			delete(r.clients, c.Id)
 		}
 	}
 	delete(r.roles, userId)
+	delete(r.members, userId)
 }
 
-// Broadcast Used for send payload to all users in room except clients from parameter excludeClientIds
+// Broadcast Used for send payload to all users in room except clients from parameter excludeClientIds, the payload is sent
+// into the clients snapshot so the room is not locked while sending
 func (r *ChatRoom) Broadcast(payload *PayloadOutput, excludeClientIds ...string) {
-	for _, client := range r.clients {
+	r.publish(&RoomBroadcast{RoomId: r.Id, Payload: payload, ExcludeClientIds: excludeClientIds})
+}
+
+// BroadcastExceptUser Works like Broadcast, but all clients of the user are excluded
+func (r *ChatRoom) BroadcastExceptUser(payload *PayloadOutput, userId string) {
+	r.publish(&RoomBroadcast{RoomId: r.Id, Payload: payload, ExcludeUserId: userId})
+}
+
+// BroadcastLocal Used to send the broadcast only into the clients on this node, each user gets the payload with its own sequence
+func (r *ChatRoom) BroadcastLocal(broadcast *RoomBroadcast) {
+	for _, client := range r.Clients() {
+		if len(broadcast.ExcludeUserId) != 0 && client.UserId == broadcast.ExcludeUserId {
+			continue
+		}
 		// Check if the client id is excluded
-		if !containers.IsExist(excludeClientIds, func(current *string) bool {
+		if !containers.IsExist(broadcast.ExcludeClientIds, func(current *string) bool {
 			return *current == client.Id
 		}) {
-			client.SendPayload(payload)
+			client.SendPayload(broadcast.Payload.WithSeq(broadcast.Seqs[client.UserId]))
+		}
+	}
+}
+
+func (r *ChatRoom) publish(broadcast *RoomBroadcast) {
+	if r.recorder != nil && broadcast.Payload.IsReplayable() {
+		memberIds := r.MemberIds()
+		userIds := make([]string, 0, len(memberIds))
+		for _, userId := range memberIds {
+			if userId != broadcast.ExcludeUserId {
+				userIds = append(userIds, userId)
+			}
 		}
+		broadcast.Seqs = r.recorder(broadcast.Payload, userIds)
+	}
+	r.BroadcastLocal(broadcast)
+	if r.publisher != nil {
+		r.publisher(broadcast)
+	}
+}
+
+// addClient Used to add the client, it should be called with membersMutex locked
+func (r *ChatRoom) addClient(client *Client, role RoomRole) {
+	r.clients[client.Id] = client
+	r.members[client.UserId] = struct{}{}
+	_, exist := r.roles[client.UserId]
+	if !exist {
+		r.roles[client.UserId] = role
 	}
 }
+
+// getClientsByUserId Works like GetClientsByUserId, it should be called with membersMutex locked
+func (r *ChatRoom) getClientsByUserId(userId string) []*Client {
+	clients := make([]*Client, 0, 3)
+	for _, c := range r.clients {
+		if userId == c.UserId {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
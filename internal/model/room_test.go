@@ -0,0 +1,260 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestClient(userId string) *Client {
+	return NewClient(userId, userId, UserRole, nil, 10, OutboundDropOldest)
+}
+
+func TestChatRoom_RemoveClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		clients    []string // user id of each client
+		removed    int      // index of the removed client
+		wantUser   string
+		wantExist  bool
+		wantOnline int
+	}{
+		{
+			name:       "last client of the user",
+			clients:    []string{"user1", "user2"},
+			removed:    0,
+			wantUser:   "user1",
+			wantExist:  false,
+			wantOnline: 1,
+		},
+		{
+			name:       "user still has other client",
+			clients:    []string{"user1", "user1", "user2"},
+			removed:    0,
+			wantUser:   "user1",
+			wantExist:  true,
+			wantOnline: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := NewChatRoom("room", "room", "", false)
+			clients := make([]*Client, 0, len(tt.clients))
+			for _, userId := range tt.clients {
+				client := newTestClient(userId)
+				clients = append(clients, client)
+				room.AddClient(client, RoomRoleUser)
+			}
+
+			room.RemoveClient(clients[tt.removed])
+			if _, exist := room.GetRoleByUserId(tt.wantUser); exist != tt.wantExist {
+				t.Errorf("GetRoleByUserId() exist = %v, want %v", exist, tt.wantExist)
+			}
+			if got := room.OnlineCount(); got != tt.wantOnline {
+				t.Errorf("OnlineCount() = %v, want %v", got, tt.wantOnline)
+			}
+		})
+	}
+}
+
+func TestChatRoom_ConcurrentJoinLeave(t *testing.T) {
+	const workers = 16
+	const clientsPerWorker = 200
+
+	room := NewChatRoom("room", "room", "", false)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < clientsPerWorker; j++ {
+				client := newTestClient(fmt.Sprint("user-", worker, "-", j%5))
+				room.AddClient(client, RoomRoleUser)
+				room.SetRole(client.UserId, RoomRoleAdmin)
+				_ = room.IsUserExist(client.UserId)
+				_ = room.UserIds()
+				room.RemoveClient(client)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(room.Clients()); got != 0 {
+		t.Errorf("Clients() length = %v, want 0", got)
+	}
+	if got := room.OnlineCount(); got != 0 {
+		t.Errorf("OnlineCount() = %v, want 0", got)
+	}
+}
+
+func TestChatRoom_ConcurrentBroadcast(t *testing.T) {
+	const members = 50
+	const broadcasts = 100
+
+	room := NewChatRoom("room", "room", "", false)
+	stayed := make([]*Client, 0, members)
+	for i := 0; i < members; i++ {
+		client := NewClient(fmt.Sprint("member-", i), "member", UserRole, nil, broadcasts, OutboundDropOldest)
+		stayed = append(stayed, client)
+		room.AddClient(client, RoomRoleUser)
+	}
+
+	var wg sync.WaitGroup
+	// Broadcast while other clients keep joining and leaving
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < broadcasts/4; j++ {
+				payload := NewPayloadOutput[any](PayloadMessage, nil)
+				room.Broadcast(&payload)
+			}
+		}(i)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < broadcasts; j++ {
+				client := newTestClient(fmt.Sprint("guest-", worker))
+				room.AddClient(client, RoomRoleUser)
+				room.RemoveClientsByUserId(client.UserId)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, client := range stayed {
+		if got := len(client.IncomingPayload); got != broadcasts {
+			t.Fatalf("client %s received %v payloads, want %v", client.UserId, got, broadcasts)
+		}
+	}
+	if got := room.OnlineCount(); got != members {
+		t.Errorf("OnlineCount() = %v, want %v", got, members)
+	}
+}
+
+func TestChatRoom_BroadcastRecorded(t *testing.T) {
+	room := NewChatRoom("room", "room", "", false)
+	online := newTestClient("online")
+	typist := newTestClient("typist")
+	room.AddClient(online, RoomRoleUser)
+	room.AddClient(typist, RoomRoleUser)
+	room.AddMembers("offline")
+
+	var recorded []string
+	room.SetRecorder(func(payload *PayloadOutput, userIds []string) map[string]uint64 {
+		seqs := make(map[string]uint64, len(userIds))
+		for i, userId := range userIds {
+			recorded = append(recorded, userId)
+			seqs[userId] = uint64(i + 1)
+		}
+		return seqs
+	})
+
+	tests := []struct {
+		name         string
+		payload      PayloadOutput
+		excludeUser  string
+		wantRecorded int
+	}{
+		{name: "all members", payload: NewPayloadOutput[any](PayloadMessage, nil), wantRecorded: 3},
+		{name: "excluded user", payload: NewPayloadOutput[any](PayloadMessage, nil), excludeUser: "typist", wantRecorded: 2},
+		{name: "coalesced payload", payload: PayloadOutput{Type: PayloadTyping, CoalesceKey: "typing"}, excludeUser: "typist", wantRecorded: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded = nil
+			room.BroadcastExceptUser(&tt.payload, tt.excludeUser)
+			if len(recorded) != tt.wantRecorded {
+				t.Errorf("recorded users = %v, want %v users", recorded, tt.wantRecorded)
+			}
+
+			got := <-online.IncomingPayload
+			if wantSeq := tt.wantRecorded != 0; (got.Seq != 0) != wantSeq {
+				t.Errorf("payload seq = %v, want sequenced %v", got.Seq, wantSeq)
+			}
+			if tt.payload.Seq != 0 {
+				t.Errorf("broadcast payload is changed, seq = %v", tt.payload.Seq)
+			}
+			if len(tt.excludeUser) == 0 {
+				<-typist.IncomingPayload
+			}
+		})
+	}
+}
+
+func TestChatRoom_ConcurrentMetadata(t *testing.T) {
+	const updates = 200
+
+	room := NewChatRoom("room", "room", "", false)
+	for i := 0; i < 10; i++ {
+		room.AddClient(NewClient(fmt.Sprint("member-", i), "member", UserRole, nil, updates, OutboundDropOldest), RoomRoleUser)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	// Update the metadata while the room is used like the room is synced from the storage
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			room.SetMetadata(RoomMetadata{
+				Name:     fmt.Sprint("room-", i),
+				OwnerId:  fmt.Sprint("member-", i%10),
+				Archived: i%2 == 0,
+			})
+			room.ReleaseOwner(fmt.Sprint("member-", i%10))
+			room.SetOwner(fmt.Sprint("member-", (i+1)%10))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			payload := NewPayloadOutput[any](PayloadMessage, nil)
+			room.Broadcast(&payload)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			metadata := room.Metadata()
+			if metadata.Archived && strings.HasSuffix(metadata.Name, "1") {
+				t.Errorf("Metadata() = %+v is mixed from different updates", metadata)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got := room.Metadata().Name; got != fmt.Sprint("room-", updates-1) {
+		t.Errorf("Metadata().Name = %v, want room-%v", got, updates-1)
+	}
+}
+
+func TestChatRoom_BroadcastRecordFailed(t *testing.T) {
+	room := NewChatRoom("room", "room", "", false)
+	client := newTestClient("user")
+	room.AddClient(client, RoomRoleUser)
+
+	var published *RoomBroadcast
+	room.SetPublisher(func(broadcast *RoomBroadcast) {
+		published = broadcast
+	})
+	// The recorder gives no sequence when the events could not be recorded in time
+	room.SetRecorder(func(payload *PayloadOutput, userIds []string) map[string]uint64 {
+		return nil
+	})
+
+	payload := NewPayloadOutput[any](PayloadMessage, nil)
+	room.Broadcast(&payload)
+
+	select {
+	case got := <-client.IncomingPayload:
+		if got.Seq != 0 {
+			t.Errorf("payload seq = %v, want 0", got.Seq)
+		}
+	default:
+		t.Fatal("payload is not delivered when the recorder failed")
+	}
+	if published == nil {
+		t.Error("payload is not published when the recorder failed")
+	}
+}
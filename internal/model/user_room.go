@@ -4,19 +4,63 @@ import (
 	"time"
 )
 
+type NotifLevel string
+
+const (
+	NotifLevelAll      NotifLevel = "all"
+	NotifLevelMentions NotifLevel = "mentions"
+	NotifLevelNone     NotifLevel = "none"
+)
+
 func NewUserRoom(roomId string, userId string, role RoomRole) UserRoom {
 	return UserRoom{
-		RoomId:    roomId,
-		UserId:    userId,
-		UserRole:  role,
-		CreatedAt: time.Now(),
+		RoomId:     roomId,
+		UserId:     userId,
+		UserRole:   role,
+		NotifLevel: NotifLevelAll,
+		CreatedAt:  time.Now(),
 	}
 }
 
 type UserRoom struct {
-	Id        uint      `gorm:"primaryKey"`
-	RoomId    string    `gorm:"not null;type:uuid;uniqueIndex:idx_name"`
-	UserId    string    `gorm:"not null;type:uuid;uniqueIndex:idx_name"`
-	UserRole  RoomRole  `gorm:"not null;type:text;default:user"`
-	CreatedAt time.Time // Used to know when the UserId joining into RoomId
+	Id          uint       `gorm:"primaryKey"`
+	RoomId      string     `gorm:"not null;type:uuid;uniqueIndex:idx_name"`
+	UserId      string     `gorm:"not null;type:uuid;uniqueIndex:idx_name"`
+	UserRole    RoomRole   `gorm:"not null;type:text;default:user"`
+	Favourite   bool       `gorm:"not null;default:false"`
+	Folder      string     `gorm:"not null;default:''"` // Personal folder name, empty folder means the room is not in any folder
+	Position    int        `gorm:"not null;default:0"`  // Custom order on user's room list
+	NotifLevel  NotifLevel `gorm:"not null;type:text;default:all"`
+	SnoozeUntil *time.Time // Notifications are not sent until the time passed
+	CreatedAt   time.Time  // Used to know when the UserId joining into RoomId
+}
+
+// IsValidNotifLevel Used to check if the level is one of the known notification levels
+func IsValidNotifLevel(level NotifLevel) bool {
+	return level == NotifLevelAll || level == NotifLevelMentions || level == NotifLevelNone
+}
+
+// ShouldNotify Used to decide whether the user should be notified for new message on the room
+func (u *UserRoom) ShouldNotify(mentioned bool, now time.Time) bool {
+	if u.SnoozeUntil != nil && now.Before(*u.SnoozeUntil) {
+		return false
+	}
+
+	switch u.NotifLevel {
+	case NotifLevelNone:
+		return false
+	case NotifLevelMentions:
+		return mentioned
+	default:
+		return true
+	}
+}
+
+// UserRoomDetail Used to get UserRoom with the room information, Name is filled with the other member's name for private room
+type UserRoomDetail struct {
+	UserRoom
+	Name     string
+	Private  bool
+	IsGroup  bool
+	Archived bool
 }
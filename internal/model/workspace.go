@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleMember WorkspaceRole = "member"
+	WorkspaceRoleAdmin  WorkspaceRole = "admin"
+)
+
+// Workspace Used to group rooms with its own membership, so the teams on the same deployment are isolated from each other
+type Workspace struct {
+	Id          string `gorm:"primaryKey;type:uuid;not null"`
+	Name        string `gorm:"not null"`
+	Description string
+	OwnerId     string `gorm:"not null;default:''"` // Owner could not leave the workspace
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func NewWorkspaceMember(workspaceId string, userId string, role WorkspaceRole) WorkspaceMember {
+	return WorkspaceMember{
+		WorkspaceId: workspaceId,
+		UserId:      userId,
+		Role:        role,
+		CreatedAt:   time.Now(),
+	}
+}
+
+type WorkspaceMember struct {
+	Id          uint          `gorm:"primaryKey"`
+	WorkspaceId string        `gorm:"not null;type:uuid;uniqueIndex:idx_workspace_member"`
+	UserId      string        `gorm:"not null;type:uuid;uniqueIndex:idx_workspace_member"`
+	Role        WorkspaceRole `gorm:"not null;type:text;default:member"`
+	CreatedAt   time.Time     // Used to know when the UserId joining into WorkspaceId
+}
+
+// WorkspaceDetail Used to get Workspace with the member's role
+type WorkspaceDetail struct {
+	Workspace
+	Role WorkspaceRole
+}
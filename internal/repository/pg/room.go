@@ -1,11 +1,26 @@
 package pg_repo
 
 import (
+	"errors"
+
 	"chatto/internal/model"
 	"chatto/internal/repository"
+	"chatto/internal/util/strutil"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
+const pgUniqueViolation = "23505"
+
+// translateError Used to convert the unique violation into repository.ErrDuplicatedKey, the other errors are returned as is
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return repository.ErrDuplicatedKey
+	}
+	return err
+}
+
 func NewRoomRepository(db *gorm.DB) repository.IRoomRepository {
 	return &roomRepository{db_: db}
 }
@@ -23,9 +38,65 @@ func (r roomRepository) CreateRoom(room *model.Room) error {
 	return result.Error
 }
 
-func (r roomRepository) FindRooms() ([]model.Room, error) {
+func (r roomRepository) CreateRoomWithMembers(room *model.Room, userRooms []model.UserRoom) error {
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		result := tx.Create(room)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, data := range userRooms {
+			result = tx.Create(&data)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+}
+
+func (r roomRepository) FindRooms(includeArchived bool) ([]model.Room, error) {
+	var rooms []model.Room
+	db := r.db()
+	if !includeArchived {
+		db = db.Where("archived = ?", false)
+	}
+	result := db.Find(&rooms)
+	return rooms, result.Error
+}
+
+func (r roomRepository) FindPublicRooms(workspaceId string, query string, offset int, limit int) ([]model.Room, int64, error) {
+	publicScope := func(db *gorm.DB) *gorm.DB {
+		db = db.Model(&model.Room{}).Where("private = ? AND invite_only = ? AND archived = ?", false, false, false)
+		if strutil.IsEmpty(workspaceId) {
+			db = db.Where("workspace_id IS NULL")
+		} else {
+			db = db.Where("workspace_id = ?", workspaceId)
+		}
+		if !strutil.IsEmpty(query) {
+			pattern := "%" + query + "%"
+			db = db.Where("name ILIKE ? OR description ILIKE ?", pattern, pattern)
+		}
+		return db
+	}
+
+	var count int64
+	result := r.db().Scopes(publicScope).Count(&count)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	var rooms []model.Room
+	result = r.db().Scopes(publicScope).Order("name ASC").Offset(offset).Limit(limit).Find(&rooms)
+	return rooms, count, result.Error
+}
+
+func (r roomRepository) FindRoomsByWorkspaceId(workspaceId string, defaultOnly bool) ([]model.Room, error) {
 	var rooms []model.Room
-	result := r.db().Find(&rooms)
+	db := r.db().Where("workspace_id = ?", workspaceId)
+	if defaultOnly {
+		db = db.Where("is_default = ?", true)
+	}
+	result := db.Find(&rooms)
 	return rooms, result.Error
 }
 
@@ -35,6 +106,68 @@ func (r roomRepository) FindRoomById(roomId string) (*model.Room, error) {
 	return &room, result.Error
 }
 
+func (r roomRepository) FindRoomByDirectKey(key string) (*model.Room, error) {
+	var room model.Room
+	result := r.db().Limit(1).Find(&room, "direct_key = ?", key)
+	return &room, result.Error
+}
+
+func (r roomRepository) BackfillDirectKeys() (int64, error) {
+	// The members are sorted by byte order like model.NewDirectKey
+	result := r.db().Exec(`UPDATE rooms SET direct_key = keys.direct_key FROM (
+		SELECT DISTINCT ON (members.direct_key) members.room_id, members.direct_key FROM (
+			SELECT room_id, string_agg(user_id::text, ':' ORDER BY user_id::text COLLATE "C") AS direct_key FROM user_rooms
+			WHERE room_id IN (SELECT id FROM rooms WHERE private AND NOT is_group AND direct_key IS NULL)
+			GROUP BY room_id HAVING COUNT(*) = 2
+		) AS members INNER JOIN rooms ON rooms.id = members.room_id
+		WHERE NOT EXISTS (SELECT 1 FROM rooms AS others WHERE others.direct_key = members.direct_key)
+		ORDER BY members.direct_key, rooms.created_at ASC
+	) AS keys WHERE rooms.id = keys.room_id`)
+	return result.RowsAffected, result.Error
+}
+
+func (r roomRepository) UpdateRoomById(roomId string, room *model.Room) error {
+	// Select all fields, so the zero value fields are updated too
+	result := r.db().Model(&model.Room{}).Where("id = ?", roomId).Select("*").Omit("id", "created_at").Updates(room)
+	return result.Error
+}
+
+func (r roomRepository) UpdateRoomArchivedById(roomId string, archived bool) error {
+	result := r.db().Model(&model.Room{}).Where("id = ?", roomId).Update("archived", archived)
+	return result.Error
+}
+
+func (r roomRepository) UpdateGroupMembers(roomId string, directKey *string, added []model.UserRoom, removedUserIds []string) error {
+	err := r.db().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Room{}).Where("id = ?", roomId).Update("direct_key", directKey)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, data := range added {
+			result = tx.Create(&data)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		if len(removedUserIds) != 0 {
+			result = tx.Where("room_id = ? AND user_id IN ?", roomId, removedUserIds).Delete(&model.UserRoom{})
+		}
+		return result.Error
+	})
+	return translateError(err)
+}
+
+func (r roomRepository) UpdateRoomOwner(roomId string, ownerId string) error {
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Room{}).Where("id = ?", roomId).Update("owner_id", ownerId)
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Model(&model.UserRoom{}).Where("room_id = ? AND user_id = ?", roomId, ownerId).Update("user_role", model.RoomRoleAdmin)
+		return result.Error
+	})
+}
+
 func (r roomRepository) FindRoomsByUserId(userId string) ([]model.Room, error) {
 	var rooms []model.Room
 	result := r.db().Raw("SELECT rooms.* FROM user_rooms INNER JOIN rooms ON rooms.id = user_rooms.room_id WHERE user_rooms.user_id = ?", userId).Scan(&rooms)
@@ -24,11 +24,26 @@ func (u userRoomRepository) GetRoomMemberCountById(roomId string) (int64, error)
 	return count, res.Error
 }
 
-func (u userRoomRepository) FindUserRoomsByUserId(userId string) ([]model.UserRoom, error) {
-	// TODO: Join with room table
+func (u userRoomRepository) FindUserRoomsByUserId(userId string) ([]model.UserRoomDetail, error) {
+	var userRooms []model.UserRoomDetail
+	result := u.db().Raw(`SELECT user_rooms.*, rooms.private, rooms.is_group, rooms.archived,
+		CASE WHEN rooms.private AND NOT rooms.is_group THEN COALESCE((SELECT users.name FROM user_rooms AS others INNER JOIN users ON users.id = others.user_id WHERE others.room_id = user_rooms.room_id AND others.user_id <> user_rooms.user_id LIMIT 1), '')
+		ELSE rooms.name END AS name
+		FROM user_rooms INNER JOIN rooms ON rooms.id = user_rooms.room_id WHERE user_rooms.user_id = ?
+		ORDER BY user_rooms.position ASC, user_rooms.created_at ASC`, userId).Scan(&userRooms)
+	return userRooms, result.Error
+}
+
+func (u userRoomRepository) FindUserRoom(roomId string, userId string) (*model.UserRoom, error) {
+	var userRoom model.UserRoom
+	result := u.db().Limit(1).Find(&userRoom, "room_id = ? AND user_id = ?", roomId, userId)
+	return &userRoom, result.Error
+}
+
+func (u userRoomRepository) FindUserRoomsByRoomId(roomId string) ([]model.UserRoom, error) {
 	var userRooms []model.UserRoom
-	err := u.db().Find(&userRooms, "user_id = ?", userId)
-	return userRooms, err.Error
+	result := u.db().Order("created_at ASC").Find(&userRooms, "room_id = ?", roomId)
+	return userRooms, result.Error
 }
 
 func (u userRoomRepository) FindUsersByRoomId(roomId string) ([]model.User, error) {
@@ -56,6 +71,29 @@ func (u userRoomRepository) AddUsersIntoRoomById(userRoom []model.UserRoom) erro
 	})
 }
 
+func (u userRoomRepository) UpdateUserRoleById(roomId string, userId string, role model.RoomRole) error {
+	result := u.db().Model(&model.UserRoom{}).Where("room_id = ? AND user_id = ?", roomId, userId).Update("user_role", role)
+	return result.Error
+}
+
+func (u userRoomRepository) UpdateUserRoomPreference(userRoom *model.UserRoom) error {
+	result := u.db().Model(&model.UserRoom{}).Where("room_id = ? AND user_id = ?", userRoom.RoomId, userRoom.UserId).
+		Select("favourite", "folder", "position", "notif_level", "snooze_until").Updates(userRoom)
+	return result.Error
+}
+
+func (u userRoomRepository) UpdateUserRoomPositions(userId string, roomIds []string) error {
+	return u.db().Transaction(func(tx *gorm.DB) error {
+		for position, roomId := range roomIds {
+			result := tx.Model(&model.UserRoom{}).Where("room_id = ? AND user_id = ?", roomId, userId).Update("position", position)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+}
+
 func (u userRoomRepository) RemoveUserFromRoomById(roomId string, userId string) error {
 	result := u.db().Where("room_id = ? AND user_id = ?", roomId, userId).Delete(&model.UserRoom{})
 	return result.Error
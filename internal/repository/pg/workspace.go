@@ -0,0 +1,116 @@
+package pg_repo
+
+import (
+	"chatto/internal/model"
+	"chatto/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func NewWorkspaceRepository(db *gorm.DB) repository.IWorkspaceRepository {
+	return &workspaceRepository{db_: db}
+}
+
+type workspaceRepository struct {
+	db_ *gorm.DB
+}
+
+func (w workspaceRepository) db() *gorm.DB {
+	return w.db_.Debug()
+}
+
+func (w workspaceRepository) CreateWorkspace(workspace *model.Workspace, owner model.WorkspaceMember) error {
+	return w.db().Transaction(func(tx *gorm.DB) error {
+		result := tx.Create(workspace)
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Create(&owner)
+		return result.Error
+	})
+}
+
+func (w workspaceRepository) FindWorkspaces() ([]model.Workspace, error) {
+	var workspaces []model.Workspace
+	result := w.db().Find(&workspaces)
+	return workspaces, result.Error
+}
+
+func (w workspaceRepository) FindWorkspaceById(workspaceId string) (*model.Workspace, error) {
+	var workspace model.Workspace
+	result := w.db().First(&workspace, "id = ?", workspaceId)
+	return &workspace, result.Error
+}
+
+func (w workspaceRepository) FindWorkspacesByUserId(userId string) ([]model.WorkspaceDetail, error) {
+	var workspaces []model.WorkspaceDetail
+	result := w.db().Raw("SELECT workspaces.*, workspace_members.role FROM workspace_members INNER JOIN workspaces ON workspaces.id = workspace_members.workspace_id WHERE workspace_members.user_id = ?", userId).Scan(&workspaces)
+	return workspaces, result.Error
+}
+
+func (w workspaceRepository) FindWorkspaceMember(workspaceId string, userId string) (*model.WorkspaceMember, error) {
+	var member model.WorkspaceMember
+	result := w.db().Limit(1).Find(&member, "workspace_id = ? AND user_id = ?", workspaceId, userId)
+	return &member, result.Error
+}
+
+func (w workspaceRepository) FindWorkspaceMembers(workspaceId string) ([]model.WorkspaceMember, error) {
+	var members []model.WorkspaceMember
+	result := w.db().Order("created_at ASC").Find(&members, "workspace_id = ?", workspaceId)
+	return members, result.Error
+}
+
+func (w workspaceRepository) AddWorkspaceMembers(members []model.WorkspaceMember, userRooms []model.UserRoom) error {
+	return w.db().Transaction(func(tx *gorm.DB) error {
+		// Existing members only get the new role
+		for _, data := range members {
+			result := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"role"}),
+			}).Create(&data)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		for _, data := range userRooms {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&data)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+}
+
+func (w workspaceRepository) RemoveWorkspaceMember(workspaceId string, userId string) error {
+	return w.db().Transaction(func(tx *gorm.DB) error {
+		roomIds := tx.Model(&model.Room{}).Select("id").Where("workspace_id = ?", workspaceId)
+		result := tx.Where("user_id = ? AND room_id IN (?)", userId, roomIds).Delete(&model.UserRoom{})
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Model(&model.Room{}).Where("workspace_id = ? AND owner_id = ?", workspaceId, userId).Update("owner_id", "")
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Where("workspace_id = ? AND user_id = ?", workspaceId, userId).Delete(&model.WorkspaceMember{})
+		return result.Error
+	})
+}
+
+func (w workspaceRepository) UpdateWorkspaceById(workspaceId string, workspace *model.Workspace) error {
+	// Select all fields, so the zero value fields are updated too
+	result := w.db().Model(&model.Workspace{}).Where("id = ?", workspaceId).Select("*").Omit("id", "created_at").Updates(workspace)
+	return result.Error
+}
+
+func (w workspaceRepository) DeleteWorkspaceById(workspaceId string) error {
+	return w.db().Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("workspace_id = ?", workspaceId).Delete(&model.WorkspaceMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Delete(&model.Workspace{}, "id = ?", workspaceId)
+		return result.Error
+	})
+}
@@ -1,14 +1,19 @@
 package redis_repo
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"chatto/internal/constant"
 	"chatto/internal/dto"
 	"chatto/internal/model"
 	"chatto/internal/repository"
 	"chatto/internal/util"
+	"chatto/internal/util/containers"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -24,7 +29,40 @@ func (c chatRepository) db() *redis.Client {
 	return c.db_
 }
 
-func (c chatRepository) NewClient(client *model.Client) error {
+// updateClientScript Used to change the user's online clients and whether the client is active, then update the idle flag atomically.
+// The user is idle when none of the clients on every node is active. It returns the online clients, the idle flag and the previous idle flag
+var updateClientScript = redis.NewScript(`
+local online = redis.call('HINCRBY', KEYS[1], 'online', ARGV[1])
+if ARGV[2] == '1' then
+	redis.call('SADD', KEYS[2], ARGV[3])
+	redis.call('EXPIRE', KEYS[2], ARGV[4])
+else
+	redis.call('SREM', KEYS[2], ARGV[3])
+end
+local idle = 0
+if online > 0 and redis.call('SCARD', KEYS[2]) == 0 then
+	idle = 1
+end
+local previous = 0
+if redis.call('HGET', KEYS[1], 'idle') == '1' then
+	previous = 1
+end
+redis.call('HSET', KEYS[1], 'idle', idle)
+return {online, idle, previous}
+`)
+
+// updateClient Used to run updateClientScript, it returns the number of online clients and true when the user's idle flag is changed
+func (c chatRepository) updateClient(ctx context.Context, client *model.Client, onlineDelta int, active bool) (int64, bool, error) {
+	keys := []string{constant.REDIS_KEY_USER + client.UserId, constant.REDIS_KEY_ACTIVE + client.UserId}
+	expiration := int64(constant.USER_CHAT_EXPIRATION_DURATION / time.Second)
+	result, err := updateClientScript.Run(ctx, c.db(), keys, onlineDelta, active, client.Id, expiration).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return result[0], result[1] != result[2], nil
+}
+
+func (c chatRepository) NewClient(client *model.Client) (bool, error) {
 	ctx, cancel := util.NewTimeoutContext()
 	defer cancel()
 	key := constant.REDIS_KEY_USER + client.UserId
@@ -32,37 +70,51 @@ func (c chatRepository) NewClient(client *model.Client) error {
 	// Check existences
 	resExist := c.db().Exists(ctx, key)
 	if resExist.Err() != nil {
-		return resExist.Err()
+		return false, resExist.Err()
 	}
 	// Only increment online field when the key is exists
-	if resExist.Val() != 0 {
-		result := c.db().HIncrBy(ctx, key, "online", 1)
+	onlineDelta := 1
+	if resExist.Val() == 0 {
+		result := c.db().HMSet(ctx, key, "name", client.Username, "role", string(client.Role), "online", 1)
 		if result.Err() != nil {
-			return result.Err()
+			return false, result.Err()
 		}
-		// Renew TTL
-		resultBool := c.db().Expire(ctx, key, constant.USER_CHAT_EXPIRATION_DURATION)
-		return resultBool.Err()
+		onlineDelta = 0
 	}
 
-	result := c.db().HMSet(ctx, key, "name", client.Username, "role", string(client.Role), "online", 1)
-	if result.Err() != nil {
-		return result.Err()
+	// New client is active, so the idle user becomes active
+	_, changed, err := c.updateClient(ctx, client, onlineDelta, true)
+	if err != nil {
+		return false, err
 	}
 	// Set TTL
-	result = c.db().Expire(ctx, key, constant.USER_CHAT_EXPIRATION_DURATION)
-	return result.Err()
+	resultBool := c.db().Expire(ctx, key, constant.USER_CHAT_EXPIRATION_DURATION)
+	return changed, resultBool.Err()
 }
 
-func (c chatRepository) RemoveClient(client *model.Client) error {
+func (c chatRepository) RemoveClient(client *model.Client) (bool, error) {
 	ctx, cancel := util.NewTimeoutContext()
 	defer cancel()
 	key := constant.REDIS_KEY_USER + client.UserId
 
-	result := c.db().HIncrBy(ctx, key, "online", -1)
-	return result.Err()
+	online, changed, err := c.updateClient(ctx, client, -1, false)
+	if err != nil || online > 0 {
+		return changed, err
+	}
+
+	resultSet := c.db().HSet(ctx, key, "last_seen", time.Now().Unix())
+	return changed, resultSet.Err()
 }
 
+// createMessageScript Used to increment the room's sequence and store the message with it atomically,
+// so the stored messages of the room never have a gap on the sequence
+var createMessageScript = redis.NewScript(`
+local seq = redis.call('HINCRBY', KEYS[1], 'seq', 1)
+redis.call('JSON.SET', KEYS[2], '$', ARGV[1])
+redis.call('JSON.SET', KEYS[2], '$.seq', seq)
+return seq
+`)
+
 func (c chatRepository) CreateMessage(message *model.Message) error {
 	ctx, cancel := util.NewTimeoutContext()
 	defer cancel()
@@ -76,8 +128,13 @@ func (c chatRepository) CreateMessage(message *model.Message) error {
 		return err
 	}
 
-	result := c.db().Do(ctx, "JSON.SET", key, "$", bytes)
-	return result.Err()
+	keys := []string{constant.REDIS_KEY_ROOM + message.ReceiverId, key}
+	seq, err := createMessageScript.Run(ctx, c.db(), keys, bytes).Uint64()
+	if err != nil {
+		return err
+	}
+	message.Seq = seq
+	return nil
 }
 
 func (c chatRepository) CreateNotification(notif *model.Notification) error {
@@ -106,12 +163,27 @@ func (c chatRepository) FindRoomChats(request *dto.MessageRequest) ([]model.Mess
 	} else {
 		query += fmt.Sprintf(" @timestamp:[%d %d]", request.FromTime, request.ToTime)
 	}
-	result := c.db().Do(ctx, "FT.SEARCH", constant.REDIS_KEY_CHAT_INDEX, query, "SORTBY", "timestamp", "ASC")
+	if request.AfterSeq != 0 {
+		query += fmt.Sprintf(" @seq:[(%d +inf]", request.AfterSeq)
+	}
+	if request.BeforeSeq != 0 {
+		query += fmt.Sprintf(" @seq:[-inf (%d]", request.BeforeSeq)
+	}
+
+	// The latest messages before the cursor are taken when paginating backward
+	order := "ASC"
+	if request.BeforeSeq != 0 && request.AfterSeq == 0 {
+		order = "DESC"
+	}
+	result := c.db().Do(ctx, "FT.SEARCH", constant.REDIS_KEY_CHAT_INDEX, query, "SORTBY", "seq", order, "LIMIT", 0, request.Limit)
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
 	_, messages := ftSearchConvert[model.Message](result.Val())
 
+	if order == "DESC" {
+		containers.SliceReverse(messages)
+	}
 	return messages, nil
 }
 
@@ -139,33 +211,162 @@ func (c chatRepository) ResetClients() error {
 	ctx, cancel := util.NewTimeoutContext()
 	defer cancel()
 
-	// Check existences
+	// Keep the users, so the presence like last seen is not lost
+	now := time.Now().Unix()
 	var cursor uint64 = 0
 	for {
-		keys, newCursor, err := c.db().Scan(ctx, cursor, "user:*", 10).Result()
+		keys, newCursor, err := c.db().Scan(ctx, cursor, constant.REDIS_KEY_USER+"*", 10).Result()
 		if err != nil {
 			return err
 		}
 
+		for _, key := range keys {
+			online, err := c.db().HGet(ctx, key, "online").Int64()
+			if err != nil || online <= 0 {
+				continue
+			}
+			if err = c.db().HSet(ctx, key, "online", 0, "last_seen", now, "idle", 0).Err(); err != nil {
+				return err
+			}
+			userId := strings.TrimPrefix(key, constant.REDIS_KEY_USER)
+			if err = c.db().Del(ctx, constant.REDIS_KEY_ACTIVE+userId).Err(); err != nil {
+				return err
+			}
+		}
+
 		if newCursor == 0 {
 			break
 		}
 		cursor = newCursor
+	}
+	return nil
+}
+
+func (c chatRepository) SetPresence(userId string, status model.PresenceStatus, statusText string, statusExpiry int64) error {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	key := constant.REDIS_KEY_USER + userId
+	result := c.db().HSet(ctx, key, "status", string(status), "status_text", statusText, "status_expiry", statusExpiry)
+	return result.Err()
+}
+
+func (c chatRepository) FindPresences(userIds []string) ([]model.Presence, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
 
-		if len(keys) != 0 {
-			c.db().Del(ctx, keys...)
+	pipe := c.db().Pipeline()
+	results := make([]*redis.SliceCmd, 0, len(userIds))
+	for _, userId := range userIds {
+		results = append(results, pipe.HMGet(ctx, constant.REDIS_KEY_USER+userId, "status", "status_text", "status_expiry", "last_seen", "online", "idle"))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	presences := make([]model.Presence, 0, len(userIds))
+	for i, result := range results {
+		var data struct {
+			Status       string `redis:"status"`
+			StatusText   string `redis:"status_text"`
+			StatusExpiry int64  `redis:"status_expiry"`
+			LastSeen     int64  `redis:"last_seen"`
+			Online       int64  `redis:"online"`
+			Idle         bool   `redis:"idle"`
+		}
+		if err := result.Scan(&data); err != nil {
+			return nil, err
 		}
+		presences = append(presences, model.Presence{
+			UserId:       userIds[i],
+			Status:       model.PresenceStatus(data.Status),
+			StatusText:   data.StatusText,
+			StatusExpiry: data.StatusExpiry,
+			LastSeen:     data.LastSeen,
+			Online:       data.Online,
+			Idle:         data.Idle,
+		})
 	}
-	//if result.Err() != nil {
-	//	return result.Err()
-	//}
-	//if result.Val() == 0 {
-	//	return errors.New("key not found")
-	//}
-	//result = c.db().HSet(ctx, key, "online", 0)
-	//
-	//return result.Err()
-	return nil
+	return presences, nil
+}
+
+func (c chatRepository) SetClientIdle(client *model.Client, idle bool) (bool, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	_, changed, err := c.updateClient(ctx, client, 0, !idle)
+	return changed, err
+}
+
+func (c chatRepository) MuteUser(roomId string, userId string, duration time.Duration) error {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	// Zero expiration will keep the key until it is deleted
+	key := constant.REDIS_KEY_MUTE + roomId + ":" + userId
+	result := c.db().Set(ctx, key, 1, duration)
+	return result.Err()
+}
+
+func (c chatRepository) UnmuteUser(roomId string, userId string) error {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	key := constant.REDIS_KEY_MUTE + roomId + ":" + userId
+	result := c.db().Del(ctx, key)
+	return result.Err()
+}
+
+func (c chatRepository) IsUserMuted(roomId string, userId string) (bool, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	key := constant.REDIS_KEY_MUTE + roomId + ":" + userId
+	result := c.db().Exists(ctx, key)
+	return result.Val() != 0, result.Err()
+}
+
+func (c chatRepository) SetSlowMode(roomId string, duration time.Duration) error {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	key := constant.REDIS_KEY_ROOM + roomId
+	if duration <= 0 {
+		result := c.db().HDel(ctx, key, "slow_mode")
+		return result.Err()
+	}
+
+	result := c.db().HSet(ctx, key, "slow_mode", int64(duration.Seconds()))
+	return result.Err()
+}
+
+func (c chatRepository) GetSlowMode(roomId string) (time.Duration, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	key := constant.REDIS_KEY_ROOM + roomId
+	seconds, err := c.db().HGet(ctx, key, "slow_mode").Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return time.Duration(seconds) * time.Second, err
+}
+
+func (c chatRepository) TakeSlowModeTurn(roomId string, userId string, duration time.Duration) (bool, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	// The key will only be created when there is no previous turn still waiting
+	key := constant.REDIS_KEY_SLOW_MODE + roomId + ":" + userId
+	return c.db().SetNX(ctx, key, 1, duration).Result()
+}
+
+func (c chatRepository) ReleaseSlowModeTurn(roomId string, userId string) error {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	key := constant.REDIS_KEY_SLOW_MODE + roomId + ":" + userId
+	return c.db().Del(ctx, key).Err()
 }
 
 func ftSearchConvert[T any](data any) (int64, []T) {
@@ -191,3 +392,108 @@ func ftSearchConvert[T any](data any) (int64, []T) {
 	}
 	return count, result
 }
+
+func (c chatRepository) SaveSession(sessionId string, userId string, duration time.Duration) error {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+	return c.db().Set(ctx, constant.REDIS_KEY_SESSION+sessionId, userId, duration).Err()
+}
+
+func (c chatRepository) FindSessionUserId(sessionId string) (string, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+	userId, err := c.db().Get(ctx, constant.REDIS_KEY_SESSION+sessionId).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return userId, err
+}
+
+// recordEventScript Used to increment the sequence and append the event atomically, so the stream is always ordered by the sequence.
+// The stream entry id is the sequence. KEYS are the sequence and the stream of each user, it returns the sequence of each user in order
+var recordEventScript = redis.NewScript(`
+local seqs = {}
+for i = 1, #KEYS, 2 do
+	local seq = redis.call('INCR', KEYS[i])
+	redis.call('XADD', KEYS[i + 1], 'MAXLEN', '~', ARGV[2], seq .. '-0', 'payload', ARGV[1])
+	redis.call('PEXPIRE', KEYS[i + 1], ARGV[3])
+	seqs[#seqs + 1] = seq
+end
+return seqs
+`)
+
+func (c chatRepository) RecordEvent(payload *model.PayloadOutput, userIds []string) (map[string]uint64, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// It is on the broadcast path, so it should not wait as long as the other queries
+	ctx, cancel := context.WithTimeout(context.Background(), constant.USER_EVENT_RECORD_TIMEOUT)
+	defer cancel()
+
+	keys := make([]string, 0, len(userIds)*2)
+	for _, userId := range userIds {
+		keys = append(keys, constant.REDIS_KEY_EVENT_SEQ+userId, constant.REDIS_KEY_EVENTS+userId)
+	}
+	results, err := recordEventScript.Run(ctx, c.db(), keys, data, constant.USER_EVENT_STREAM_SIZE, constant.USER_EVENT_EXPIRATION_DURATION.Milliseconds()).Uint64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(userIds) {
+		return nil, fmt.Errorf("recorded %d events for %d users", len(results), len(userIds))
+	}
+
+	seqs := make(map[string]uint64, len(userIds))
+	for i, seq := range results {
+		seqs[userIds[i]] = seq
+	}
+	return seqs, nil
+}
+
+func (c chatRepository) GetEventSeq(userId string) (uint64, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+	seq, err := c.db().Get(ctx, constant.REDIS_KEY_EVENT_SEQ+userId).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return seq, err
+}
+
+func (c chatRepository) FindEventsAfter(userId string, seq uint64) ([]model.PayloadOutput, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+
+	messages, err := c.db().XRange(ctx, constant.REDIS_KEY_EVENTS+userId, fmt.Sprintf("%d-0", seq+1), "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]model.PayloadOutput, 0, len(messages))
+	for _, message := range messages {
+		var entrySeq uint64
+		if _, err = fmt.Sscanf(message.ID, "%d-", &entrySeq); err != nil {
+			return nil, err
+		}
+		raw, _ := message.Values["payload"].(string)
+
+		var stored struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err = json.Unmarshal([]byte(raw), &stored); err != nil {
+			return nil, err
+		}
+		payload := model.PayloadOutput{Type: stored.Type, Seq: entrySeq}
+		// Keep omitted data as nil
+		if len(stored.Data) != 0 {
+			payload.Data = stored.Data
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
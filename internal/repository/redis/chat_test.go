@@ -0,0 +1,83 @@
+package redis_repo
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"chatto/internal/constant"
+	"chatto/internal/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestChatRepository_RecordEvent(t *testing.T) {
+	server := miniredis.RunT(t)
+	repo := chatRepository{db_: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+	// User with previous events continues its own sequence
+	server.Set(constant.REDIS_KEY_EVENT_SEQ+"user3", "5")
+
+	payload := model.NewPayloadOutput[any](model.PayloadMessage, nil)
+	tests := []struct {
+		name    string
+		userIds []string
+		want    map[string]uint64
+	}{
+		{name: "first events", userIds: []string{"user1", "user2", "user3"}, want: map[string]uint64{"user1": 1, "user2": 1, "user3": 6}},
+		{name: "next events", userIds: []string{"user1", "user3"}, want: map[string]uint64{"user1": 2, "user3": 7}},
+		{name: "no users", userIds: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.RecordEvent(&payload, tt.userIds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("RecordEvent() = %v, want %v", got, tt.want)
+			}
+			for userId, seq := range tt.want {
+				if got[userId] != seq {
+					t.Errorf("RecordEvent() seq of %s = %v, want %v", userId, got[userId], seq)
+				}
+			}
+		})
+	}
+
+	events, err := repo.FindEventsAfter("user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Seq != 2 {
+		t.Errorf("FindEventsAfter() = %v, want single event with seq 2", events)
+	}
+}
+
+func TestChatRepository_RecordEventSlow(t *testing.T) {
+	// Server that accepts the connection but never replies
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Kept open until the listener is closed
+			defer conn.Close()
+		}
+	}()
+
+	repo := chatRepository{db_: redis.NewClient(&redis.Options{Addr: listener.Addr().String(), ContextTimeoutEnabled: true})}
+	payload := model.NewPayloadOutput[any](model.PayloadMessage, nil)
+	start := time.Now()
+	if _, err = repo.RecordEvent(&payload, []string{"user1", "user2"}); err == nil {
+		t.Fatal("RecordEvent() error = nil, want timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*constant.USER_EVENT_RECORD_TIMEOUT {
+		t.Errorf("RecordEvent() took %v, want at most %v", elapsed, 2*constant.USER_EVENT_RECORD_TIMEOUT)
+	}
+}
@@ -0,0 +1,232 @@
+package redis_repo
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"chatto/internal/constant"
+	"chatto/internal/model"
+	"chatto/internal/util"
+	"github.com/redis/go-redis/v9"
+)
+
+// legacyTimestampLimit Used to detect the timestamps stored in seconds, the timestamps in milliseconds are always greater than it
+const legacyTimestampLimit = 100_000_000_000
+
+const migrationScanCount = 100
+
+// backfillRoomSeqScript Used to put the legacy messages before the room's sequenced messages atomically, it is aborted when
+// the room's sequence is changed since the messages are scanned. KEYS[1] is the room, the legacy messages ordered by the timestamp
+// are followed by the sequenced messages. ARGV[1] is the expected room's sequence followed by the timestamp of each legacy message
+var backfillRoomSeqScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], 'seq') or '0')
+if current ~= tonumber(ARGV[1]) then
+	return -1
+end
+local legacy = #ARGV - 1
+for i = 1, legacy do
+	redis.call('JSON.SET', KEYS[i + 1], '$.seq', i)
+	redis.call('JSON.SET', KEYS[i + 1], '$.ts', ARGV[i + 1])
+end
+for i = legacy + 2, #KEYS do
+	redis.call('JSON.NUMINCRBY', KEYS[i], '$.seq', legacy)
+end
+redis.call('HINCRBY', KEYS[1], 'seq', legacy)
+return legacy
+`)
+
+// legacyTimestamp Used to convert the timestamp in seconds into milliseconds, the timestamp in milliseconds is returned as is
+func legacyTimestamp(ts int64) (int64, bool) {
+	if ts >= legacyTimestampLimit {
+		return ts, false
+	}
+	return ts * 1000, true
+}
+
+func (c chatRepository) MigrateLegacyChats() (int, error) {
+	ctx, cancel := util.NewTimeoutContext()
+	exist, err := c.db().Exists(ctx, constant.REDIS_KEY_MIGRATION_CHAT_SEQ).Result()
+	cancel()
+	if err != nil || exist != 0 {
+		return 0, err
+	}
+
+	// The sequences are taken before the messages, so the room changed while scanning could be detected
+	roomSeqs, err := c.scanRoomSeqs()
+	if err != nil {
+		return 0, err
+	}
+	messages, err := scanJSON[model.Message](c, constant.REDIS_KEY_CHAT)
+	if err != nil {
+		return 0, err
+	}
+
+	type roomMessages struct {
+		legacy    []string
+		sequenced []string
+	}
+	rooms := make(map[string]*roomMessages)
+	for key, message := range messages {
+		room, exist := rooms[message.ReceiverId]
+		if !exist {
+			room = &roomMessages{}
+			rooms[message.ReceiverId] = room
+		}
+		if message.Seq == 0 {
+			room.legacy = append(room.legacy, key)
+		} else {
+			room.sequenced = append(room.sequenced, key)
+		}
+	}
+
+	migrated := 0
+	complete := true
+	for roomId, room := range rooms {
+		if len(room.legacy) == 0 {
+			continue
+		}
+		sort.Slice(room.legacy, func(i, j int) bool {
+			first, second := messages[room.legacy[i]], messages[room.legacy[j]]
+			if first.Timestamp != second.Timestamp {
+				return first.Timestamp < second.Timestamp
+			}
+			return first.Id < second.Id
+		})
+
+		keys := make([]string, 0, len(room.legacy)+len(room.sequenced)+1)
+		keys = append(keys, constant.REDIS_KEY_ROOM+roomId)
+		keys = append(keys, room.legacy...)
+		keys = append(keys, room.sequenced...)
+		args := make([]any, 0, len(room.legacy)+1)
+		args = append(args, roomSeqs[roomId])
+		for _, key := range room.legacy {
+			ts, _ := legacyTimestamp(messages[key].Timestamp)
+			args = append(args, ts)
+		}
+
+		ctx, cancel = util.NewTimeoutContext()
+		count, err := backfillRoomSeqScript.Run(ctx, c.db(), keys, args...).Int()
+		cancel()
+		if err != nil {
+			return migrated, err
+		}
+		if count < 0 {
+			// Retried on the next start
+			log.Println("Room ", roomId, " is changed while migrating the messages")
+			complete = false
+			continue
+		}
+		migrated += count
+	}
+
+	if err = c.migrateNotificationTimestamps(); err != nil {
+		return migrated, err
+	}
+	if !complete {
+		return migrated, nil
+	}
+
+	ctx, cancel = util.NewTimeoutContext()
+	defer cancel()
+	return migrated, c.db().Set(ctx, constant.REDIS_KEY_MIGRATION_CHAT_SEQ, 1, 0).Err()
+}
+
+// migrateNotificationTimestamps Used to convert the notification timestamps stored in seconds into milliseconds
+func (c chatRepository) migrateNotificationTimestamps() error {
+	notifs, err := scanJSON[model.Notification](c, constant.REDIS_KEY_NOTIF)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+	pipe := c.db().Pipeline()
+	for key, notif := range notifs {
+		if ts, legacy := legacyTimestamp(notif.Timestamp); legacy {
+			pipe.Do(ctx, "JSON.SET", key, "$.ts", ts)
+		}
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// scanRoomSeqs Used to get the current sequence of all the rooms, the room without sequence is omitted
+func (c chatRepository) scanRoomSeqs() (map[string]int64, error) {
+	seqs := make(map[string]int64)
+	var cursor uint64 = 0
+	for {
+		ctx, cancel := util.NewTimeoutContext()
+		keys, newCursor, err := c.db().Scan(ctx, cursor, constant.REDIS_KEY_ROOM+"*", migrationScanCount).Result()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		pipe := c.db().Pipeline()
+		results := make([]*redis.StringCmd, 0, len(keys))
+		for _, key := range keys {
+			results = append(results, pipe.HGet(ctx, key, "seq"))
+		}
+		_, err = pipe.Exec(ctx)
+		cancel()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		for i, result := range results {
+			if seq, err := result.Int64(); err == nil {
+				seqs[strings.TrimPrefix(keys[i], constant.REDIS_KEY_ROOM)] = seq
+			}
+		}
+
+		if newCursor == 0 {
+			return seqs, nil
+		}
+		cursor = newCursor
+	}
+}
+
+// scanJSON Used to get all the JSON documents with the key prefix
+func scanJSON[T any](c chatRepository, prefix string) (map[string]T, error) {
+	documents := make(map[string]T)
+	var cursor uint64 = 0
+	for {
+		ctx, cancel := util.NewTimeoutContext()
+		keys, newCursor, err := c.db().Scan(ctx, cursor, prefix+"*", migrationScanCount).Result()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		pipe := c.db().Pipeline()
+		results := make([]*redis.Cmd, 0, len(keys))
+		for _, key := range keys {
+			results = append(results, pipe.Do(ctx, "JSON.GET", key, "$"))
+		}
+		_, err = pipe.Exec(ctx)
+		cancel()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		for i, result := range results {
+			// The document could be expired while scanning
+			raw, err := result.Text()
+			if err != nil {
+				continue
+			}
+			var values []T
+			if err = json.Unmarshal([]byte(raw), &values); err != nil || len(values) == 0 {
+				log.Println("Malformed document ", keys[i], ": ", err)
+				continue
+			}
+			documents[keys[i]] = values[0]
+		}
+
+		if newCursor == 0 {
+			return documents, nil
+		}
+		cursor = newCursor
+	}
+}
@@ -1,10 +1,16 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"chatto/internal/dto"
 	"chatto/internal/model"
 )
 
+// ErrDuplicatedKey Used when the unique constraint is violated, only returned by the repositories that document it
+var ErrDuplicatedKey = errors.New("duplicated key")
+
 type IUserRepository interface {
 	FindUsers() ([]model.User, error)
 	FindUserById(id string) (*model.User, error)
@@ -28,18 +34,68 @@ type IAuthRepository interface {
 
 type IRoomRepository interface {
 	CreateRoom(room *model.Room) error
-	FindRooms() ([]model.Room, error)
+	// CreateRoomWithMembers Used to create room and add the members atomically
+	CreateRoomWithMembers(room *model.Room, userRooms []model.UserRoom) error
+	// FindRooms Used to get all rooms, archived rooms are only included when includeArchived is true
+	FindRooms(includeArchived bool) ([]model.Room, error)
+	// FindPublicRooms Used to get non-private and non-invite-only rooms of the workspace which name or description contains the query, it also returns the total rooms.
+	// Empty workspaceId is used to get global rooms
+	FindPublicRooms(workspaceId string, query string, offset int, limit int) ([]model.Room, int64, error)
+	// FindRoomsByWorkspaceId Used to get all rooms of the workspace, only default rooms are included when defaultOnly is true
+	FindRoomsByWorkspaceId(workspaceId string, defaultOnly bool) ([]model.Room, error)
 	FindRoomById(roomId string) (*model.Room, error)
+	// FindRoomByDirectKey Used to get private room by the normalized members key, the room id will be empty when it is not found
+	FindRoomByDirectKey(key string) (*model.Room, error)
+	// BackfillDirectKeys Used to set the direct key of the private rooms created before the key exists, only the oldest room of the same
+	// members is deduplicated. It returns the number of updated rooms
+	BackfillDirectKeys() (int64, error)
+	UpdateRoomById(roomId string, room *model.Room) error
+	UpdateRoomArchivedById(roomId string, archived bool) error
+	// UpdateGroupMembers Used to add and remove group room's members atomically, the direct key should be the key of the new members.
+	// It returns ErrDuplicatedKey when another room has the same direct key
+	UpdateGroupMembers(roomId string, directKey *string, added []model.UserRoom, removedUserIds []string) error
+	// UpdateRoomOwner Used to set the room's owner and promote the owner as room's admin
+	UpdateRoomOwner(roomId string, ownerId string) error
 	DeleteRoomById(roomId string) error
 	FindRoomsByUserId(userId string) ([]model.Room, error)
 }
 
+type IWorkspaceRepository interface {
+	// CreateWorkspace Used to create workspace and add the owner as member atomically
+	CreateWorkspace(workspace *model.Workspace, owner model.WorkspaceMember) error
+	FindWorkspaces() ([]model.Workspace, error)
+	FindWorkspaceById(workspaceId string) (*model.Workspace, error)
+	// FindWorkspacesByUserId Used to get all user's workspaces with the user's role
+	FindWorkspacesByUserId(userId string) ([]model.WorkspaceDetail, error)
+	// FindWorkspaceMember Used to get the member of workspace, the member id will be 0 when it is not found
+	FindWorkspaceMember(workspaceId string, userId string) (*model.WorkspaceMember, error)
+	FindWorkspaceMembers(workspaceId string) ([]model.WorkspaceMember, error)
+	// AddWorkspaceMembers Used to add members and join them into the rooms atomically, the existing workspace members will have the new role
+	// and the existing room members will be ignored
+	AddWorkspaceMembers(members []model.WorkspaceMember, userRooms []model.UserRoom) error
+	// RemoveWorkspaceMember Used to remove the member and all its workspace's rooms atomically, the room ownership is also released
+	RemoveWorkspaceMember(workspaceId string, userId string) error
+	UpdateWorkspaceById(workspaceId string, workspace *model.Workspace) error
+	// DeleteWorkspaceById Used to delete workspace and all of its members
+	DeleteWorkspaceById(workspaceId string) error
+}
+
 type IUserRoomRepository interface {
 	GetUserIdsOnRoomById(roomId string) ([]string, error)
 	GetRoomMemberCountById(roomId string) (int64, error)
-	FindUserRoomsByUserId(userId string) ([]model.UserRoom, error)
+	// FindUserRoomsByUserId Used to get all user's rooms with the room name, direct room is named by the other member
+	FindUserRoomsByUserId(userId string) ([]model.UserRoomDetail, error)
+	// FindUserRoom Used to get the user's membership of the room, the id will be 0 when it is not found
+	FindUserRoom(roomId string, userId string) (*model.UserRoom, error)
+	// FindUserRoomsByRoomId Used to get all members of the room ordered by the joined time
+	FindUserRoomsByRoomId(roomId string) ([]model.UserRoom, error)
 	FindUsersByRoomId(roomId string) ([]model.User, error)
 	AddUsersIntoRoomById(userRoom []model.UserRoom) error
+	UpdateUserRoleById(roomId string, userId string, role model.RoomRole) error
+	// UpdateUserRoomPreference Used to update user's preferences of the room like favourite, folder, position and notification level
+	UpdateUserRoomPreference(userRoom *model.UserRoom) error
+	// UpdateUserRoomPositions Used to set the position of user's rooms based on the index atomically
+	UpdateUserRoomPositions(userId string, roomIds []string) error
 	RemoveUserFromRoomById(roomId string, userId string) error
 	RemoveAllUsersFromRoomById(roomId string) error
 	RemoveUsersFromRoomById(roomId string, userId []string) error
@@ -51,14 +107,50 @@ type IChatRepository interface {
 	CreateMessage(message *model.Message) error
 	// CreateNotification Will store new notification
 	CreateNotification(notif *model.Notification) error
+	// MigrateLegacyChats Used to give the messages stored before the room sequence exists their sequence ordered by the timestamp, and convert
+	// the legacy timestamps of the messages and notifications into milliseconds. It only runs once and returns the number of migrated messages
+	MigrateLegacyChats() (int, error)
 	// FindRoomChats Used to get all chats based on the roomId and range time
 	FindRoomChats(request *dto.MessageRequest) ([]model.Message, error)
 	// FindRoomNotifications Used to get all notifications based on the roomId and range time
 	FindRoomNotifications(request *dto.NotificationRequest) ([]model.Notification, error)
-	// NewClient Used to either create new key or increment "online" key by 1
-	NewClient(client *model.Client) error
-	// RemoveClient Decrement "online" key by 1
-	RemoveClient(client *model.Client) error
-	// ResetClients Used to reset online field to 0
+	// NewClient Used to either create new key or increment "online" key by 1, the client is counted as active.
+	// It returns true when the user's idle flag is changed
+	NewClient(client *model.Client) (bool, error)
+	// RemoveClient Decrement "online" key by 1, last seen time will be updated when there is no client left.
+	// It returns true when the user's idle flag is changed
+	RemoveClient(client *model.Client) (bool, error)
+	// ResetClients Used to reset online field to 0, the connected users will be seen at the time
 	ResetClients() error
+	// SetPresence Used to set user's presence status and status text, zero expiry will keep the status text
+	SetPresence(userId string, status model.PresenceStatus, statusText string, statusExpiry int64) error
+	// FindPresences Used to get the presence of the users, the user without data will be treated as disconnected
+	FindPresences(userIds []string) ([]model.Presence, error)
+	// SetClientIdle Used to mark the client as idle or active, the user is idle when none of its clients on every node is active.
+	// The idle flag is separated from the status so the user's status is kept when it becomes active. It returns true when the user's idle flag is changed
+	SetClientIdle(client *model.Client, idle bool) (bool, error)
+	// MuteUser Used to prevent user sending message into the room, zero duration will mute the user until UnmuteUser called
+	MuteUser(roomId string, userId string, duration time.Duration) error
+	// UnmuteUser Used to remove muted state of the user on the room
+	UnmuteUser(roomId string, userId string) error
+	// IsUserMuted Used to check if the user is still muted on the room
+	IsUserMuted(roomId string, userId string) (bool, error)
+	// SetSlowMode Used to set room's slow mode duration, zero duration will disable it
+	SetSlowMode(roomId string, duration time.Duration) error
+	// GetSlowMode Used to get room's slow mode duration, it will return 0 when the slow mode is disabled
+	GetSlowMode(roomId string) (time.Duration, error)
+	// TakeSlowModeTurn Used to reserve user's turn to send message, it returns false when the user should still wait
+	TakeSlowModeTurn(roomId string, userId string, duration time.Duration) (bool, error)
+	// ReleaseSlowModeTurn Used to cancel user's turn, so the user could send message right away
+	ReleaseSlowModeTurn(roomId string, userId string) error
+	// SaveSession Used to create or extend the session of the user until the duration
+	SaveSession(sessionId string, userId string, duration time.Duration) error
+	// FindSessionUserId Used to get the user id of the session, it returns empty string when the session is expired
+	FindSessionUserId(sessionId string) (string, error)
+	// RecordEvent Used to append the payload into each user's event stream, it returns the sequence given for each user
+	RecordEvent(payload *model.PayloadOutput, userIds []string) (map[string]uint64, error)
+	// GetEventSeq Used to get the latest event sequence of the user
+	GetEventSeq(userId string) (uint64, error)
+	// FindEventsAfter Used to get the kept events of the user with sequence greater than seq in order
+	FindEventsAfter(userId string, seq uint64) ([]model.PayloadOutput, error)
 }
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"net/http"
+
+	"chatto/internal/model/common"
+	"chatto/internal/rest/middleware"
+	"chatto/internal/service"
+	"chatto/internal/util/httputil"
+	"github.com/gin-gonic/gin"
+)
+
+func NewMetricsController(chatService service.IChatService) IController {
+	return metricsController{chatService: chatService}
+}
+
+type metricsController struct {
+	chatService service.IChatService
+}
+
+func (m metricsController) Route(router gin.IRouter, middlewares *middleware.Middleware) {
+	metricsRoute := router.Group("/metrics", middlewares.UserAgent, middlewares.TokenValidation, middlewares.AdminPrivilege)
+	metricsRoute.GET("/outbound", m.GetOutboundMetrics)
+}
+
+func (m metricsController) GetOutboundMetrics(ctx *gin.Context) {
+	httputil.SuccessResponse(ctx, http.StatusOK, common.NoError(), m.chatService.GetOutboundMetrics())
+}
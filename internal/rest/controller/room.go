@@ -9,23 +9,31 @@ import (
 	"chatto/internal/model/common"
 	"chatto/internal/rest/middleware"
 	"chatto/internal/service"
+	"chatto/internal/util"
 	"chatto/internal/util/httputil"
 	"chatto/internal/util/strutil"
 	"github.com/gin-gonic/gin"
 )
 
-func NewRoomController(roomService service.IRoomService) IController {
-	return roomController{roomService: roomService}
+func NewRoomController(roomService service.IRoomService, chatService service.IChatService) IController {
+	return roomController{roomService: roomService, chatService: chatService}
 }
 
 type roomController struct {
 	roomService service.IRoomService
+	chatService service.IChatService
 }
 
 func (r roomController) Route(router gin.IRouter, middlewares *middleware.Middleware) {
-	roomRoute := router.Group("/rooms", middlewares.UserAgent, middlewares.TokenValidation, middlewares.AdminPrivilege)
+	roomRoute := router.Group("/rooms", middlewares.UserAgent, middlewares.TokenValidation)
+	roomRoute.GET("/browse", r.BrowseRooms)
+
+	roomRoute.Use(middlewares.AdminPrivilege)
 	roomRoute.GET("/:id", r.GetRoomById)
 	roomRoute.POST("/", r.CreateRoom)
+	roomRoute.PATCH("/:id", r.UpdateRoomById)
+	roomRoute.POST("/:id/archive", r.ArchiveRoomById)
+	roomRoute.POST("/:id/restore", r.RestoreRoomById)
 	roomRoute.DELETE("/:id", r.DeleteRoomById)
 
 	roomRoute.GET("/", r.GetAllRoom)
@@ -54,6 +62,9 @@ func (r roomController) AddUserIntoRoomById(ctx *gin.Context) {
 	}
 
 	err := r.roomService.AddUsersInRoom(input, false)
+	if !err.IsError() {
+		err = r.chatService.RefreshRooms(roomId)
+	}
 	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, nil)
 }
 
@@ -71,6 +82,9 @@ func (r roomController) RemoveUserFromRoomById(ctx *gin.Context) {
 	}
 
 	err := r.roomService.RemoveUsersInRoom(input)
+	if !err.IsError() {
+		err = r.chatService.RefreshRooms(roomId)
+	}
 	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, nil)
 }
 
@@ -81,15 +95,29 @@ func (r roomController) CreateRoom(ctx *gin.Context) {
 		return
 	}
 
-	roomOutput, err := r.roomService.CreateRoom(&createRoom)
+	roomOutput, err := r.chatService.CreateRoomWithMembers(&createRoom)
 	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusCreated, roomOutput)
 }
 
 func (r roomController) GetAllRoom(ctx *gin.Context) {
-	rm, err := r.roomService.FindRooms()
+	includeArchived := ctx.DefaultQuery("archived", "0") == "1"
+
+	rm, err := r.roomService.FindRooms(includeArchived)
 	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, rm)
 }
 
+func (r roomController) BrowseRooms(ctx *gin.Context) {
+	var input dto.BrowseRoomInput
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_BAD_BODY_REQUEST))
+		return
+	}
+
+	claims, _ := util.GetContextValue[model.AccessTokenClaims](constant.KEY_JWT_CLAIMS, ctx)
+	output, err := r.chatService.BrowseRooms(claims.UserId, &input)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, output)
+}
+
 func (r roomController) GetRoomById(ctx *gin.Context) {
 	roomId := ctx.Param("id")
 	if strutil.IsEmpty(roomId) {
@@ -101,6 +129,44 @@ func (r roomController) GetRoomById(ctx *gin.Context) {
 	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, rm)
 }
 
+func (r roomController) UpdateRoomById(ctx *gin.Context) {
+	roomId := ctx.Param("id")
+	if strutil.IsEmpty(roomId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	var input dto.UpdateRoomInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_BAD_BODY_REQUEST))
+		return
+	}
+	input.RoomId = roomId
+
+	// Use chat service, so the connected members get the changes
+	rm, err := r.chatService.UpdateRoomById(roomId, &input)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, rm)
+}
+
+func (r roomController) ArchiveRoomById(ctx *gin.Context) {
+	r.setRoomArchived(ctx, true)
+}
+
+func (r roomController) RestoreRoomById(ctx *gin.Context) {
+	r.setRoomArchived(ctx, false)
+}
+
+func (r roomController) setRoomArchived(ctx *gin.Context, archived bool) {
+	roomId := ctx.Param("id")
+	if strutil.IsEmpty(roomId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	rm, err := r.chatService.SetRoomArchivedById(roomId, archived)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, rm)
+}
+
 func (r roomController) DeleteRoomById(ctx *gin.Context) {
 	roomId := ctx.Param("id")
 	if strutil.IsEmpty(roomId) {
@@ -110,5 +176,8 @@ func (r roomController) DeleteRoomById(ctx *gin.Context) {
 	force := ctx.DefaultQuery("force", "0") == "1"
 
 	err := r.roomService.DeleteRoomById(roomId, force)
+	if !err.IsError() {
+		err = r.chatService.RefreshRooms(roomId)
+	}
 	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, nil)
 }
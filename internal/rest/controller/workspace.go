@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"net/http"
+
+	"chatto/internal/constant"
+	"chatto/internal/dto"
+	"chatto/internal/model"
+	"chatto/internal/model/common"
+	"chatto/internal/rest/middleware"
+	"chatto/internal/service"
+	"chatto/internal/util"
+	"chatto/internal/util/httputil"
+	"chatto/internal/util/strutil"
+	"github.com/gin-gonic/gin"
+)
+
+func NewWorkspaceController(workspaceService service.IWorkspaceService, chatService service.IChatService) IController {
+	return workspaceController{workspaceService: workspaceService, chatService: chatService}
+}
+
+type workspaceController struct {
+	workspaceService service.IWorkspaceService
+	chatService      service.IChatService
+}
+
+func (w workspaceController) Route(router gin.IRouter, middlewares *middleware.Middleware) {
+	workspaceRoute := router.Group("/workspaces", middlewares.UserAgent, middlewares.TokenValidation)
+	workspaceRoute.GET("/me", w.GetUserWorkspaces)
+
+	workspaceRoute.Use(middlewares.AdminPrivilege)
+	workspaceRoute.GET("/:id", w.GetWorkspaceById)
+	workspaceRoute.POST("/", w.CreateWorkspace)
+	workspaceRoute.PATCH("/:id", w.UpdateWorkspaceById)
+	workspaceRoute.DELETE("/:id", w.DeleteWorkspaceById)
+	workspaceRoute.GET("/:id/members", w.GetWorkspaceMembers)
+	workspaceRoute.POST("/:id/members", w.AddWorkspaceMembers)
+	workspaceRoute.DELETE("/:id/members/:userId", w.RemoveWorkspaceMember)
+
+	workspaceRoute.GET("/", w.GetAllWorkspace)
+}
+
+func (w workspaceController) CreateWorkspace(ctx *gin.Context) {
+	var input dto.CreateWorkspaceInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_BAD_BODY_REQUEST))
+		return
+	}
+
+	// Creator is the owner of the workspace
+	claims, _ := util.GetContextValue[model.AccessTokenClaims](constant.KEY_JWT_CLAIMS, ctx)
+	output, err := w.workspaceService.CreateWorkspace(claims.UserId, &input)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusCreated, output)
+}
+
+func (w workspaceController) GetAllWorkspace(ctx *gin.Context) {
+	workspaces, err := w.workspaceService.FindWorkspaces()
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, workspaces)
+}
+
+func (w workspaceController) GetUserWorkspaces(ctx *gin.Context) {
+	claims, _ := util.GetContextValue[model.AccessTokenClaims](constant.KEY_JWT_CLAIMS, ctx)
+	workspaces, err := w.workspaceService.FindWorkspacesByUserId(claims.UserId)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, workspaces)
+}
+
+func (w workspaceController) GetWorkspaceById(ctx *gin.Context) {
+	workspaceId := ctx.Param("id")
+	if strutil.IsEmpty(workspaceId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	workspace, err := w.workspaceService.FindWorkspaceById(workspaceId)
+	httputil.ConditionalResponse(ctx, err, http.StatusNotFound, http.StatusOK, workspace)
+}
+
+func (w workspaceController) UpdateWorkspaceById(ctx *gin.Context) {
+	workspaceId := ctx.Param("id")
+	if strutil.IsEmpty(workspaceId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	var input dto.UpdateWorkspaceInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_BAD_BODY_REQUEST))
+		return
+	}
+
+	workspace, err := w.workspaceService.UpdateWorkspaceById(workspaceId, &input)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, workspace)
+}
+
+func (w workspaceController) DeleteWorkspaceById(ctx *gin.Context) {
+	workspaceId := ctx.Param("id")
+	if strutil.IsEmpty(workspaceId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	err := w.workspaceService.DeleteWorkspaceById(workspaceId)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, nil)
+}
+
+func (w workspaceController) GetWorkspaceMembers(ctx *gin.Context) {
+	workspaceId := ctx.Param("id")
+	if strutil.IsEmpty(workspaceId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	members, err := w.workspaceService.FindWorkspaceMembers(workspaceId)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, members)
+}
+
+func (w workspaceController) AddWorkspaceMembers(ctx *gin.Context) {
+	workspaceId := ctx.Param("id")
+	if strutil.IsEmpty(workspaceId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	var input dto.WorkspaceMemberInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_BAD_BODY_REQUEST))
+		return
+	}
+	input.WorkspaceId = workspaceId
+
+	// Use chat service, so the connected users join the default rooms
+	err := w.chatService.AddWorkspaceMembers(input)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, nil)
+}
+
+func (w workspaceController) RemoveWorkspaceMember(ctx *gin.Context) {
+	workspaceId := ctx.Param("id")
+	userId := ctx.Param("userId")
+	if strutil.IsEmpty(workspaceId) || strutil.IsEmpty(userId) {
+		httputil.ErrorResponse(ctx, http.StatusBadRequest, common.NewError(common.BAD_PARAMETER_ERROR, constant.MSG_URI_PARAM_MISSING))
+		return
+	}
+
+	err := w.chatService.RemoveWorkspaceMember(workspaceId, userId)
+	httputil.ConditionalResponse(ctx, err, http.StatusInternalServerError, http.StatusOK, nil)
+}
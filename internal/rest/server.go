@@ -13,10 +13,12 @@ type Server struct {
 	Config *config.AppConfig
 	Router gin.IRouter
 
-	UserService service.IUserService
-	AuthService service.IAuthService
-	RoomService service.IRoomService
-	Middleware  *middleware.Middleware
+	UserService      service.IUserService
+	AuthService      service.IAuthService
+	RoomService      service.IRoomService
+	ChatService      service.IChatService
+	WorkspaceService service.IWorkspaceService
+	Middleware       *middleware.Middleware
 }
 
 func (s *Server) registerControllers(controllers ...controller.IController) {
@@ -29,8 +31,10 @@ func (s *Server) registerControllers(controllers ...controller.IController) {
 func (s *Server) Setup() {
 	userController := controller.NewUserController(s.UserService)
 	authController := controller.NewAuthController(s.AuthService)
-	roomController := controller.NewRoomController(s.RoomService)
+	roomController := controller.NewRoomController(s.RoomService, s.ChatService)
+	workspaceController := controller.NewWorkspaceController(s.WorkspaceService, s.ChatService)
+	metricsController := controller.NewMetricsController(s.ChatService)
 
 	// Handle REST API routes
-	s.registerControllers(userController, authController, roomController)
+	s.registerControllers(userController, authController, roomController, workspaceController, metricsController)
 }
@@ -2,6 +2,7 @@ package service
 
 import (
 	"log"
+	"time"
 
 	"chatto/internal/constant"
 	"chatto/internal/dto"
@@ -9,7 +10,10 @@ import (
 	"chatto/internal/model/common"
 	"chatto/internal/repository"
 	"chatto/internal/util/containers"
+	"chatto/internal/util/strutil"
 	"chatto/internal/ws/manager"
+
+	"github.com/google/uuid"
 )
 
 type IChatService interface {
@@ -18,28 +22,102 @@ type IChatService interface {
 	// NewClient Used for when new sender online, it will interact with clientManager and roomManager
 	NewClient(sender *model.Client) common.Error
 	CreateRoom(sender *model.Client, input *dto.CreateRoomInput) (dto.CreateRoomOutput, common.Error)
+	// CreateRoomWithMembers Works like CreateRoom without the sender, the members should be on the room's workspace
+	CreateRoomWithMembers(input *dto.CreateRoomInput) (dto.CreateRoomOutput, common.Error)
+	// OpenDirectRoom Used to get private room between sender and the user, the room will be created when it is not exists yet
+	OpenDirectRoom(sender *model.Client, input dto.DirectRoomInput) (dto.UserRoomResponse, common.Error)
+	// OpenGroupRoom Used to get private room between sender and the users, the room will be created when it is not exists yet
+	OpenGroupRoom(sender *model.Client, input dto.GroupRoomInput) (dto.UserRoomResponse, common.Error)
 	RemoveClient(sender *model.Client) common.Error
 	NewMessage(sender *model.Client, message *dto.MessageInput) (dto.MessageOutput, common.Error)
 	NewNotification(senderUserId string, input *dto.NotificationInput) (dto.NotificationOutput, common.Error)
 	GetUsersByName(sender *model.Client, name string) (dto.GetUserOutput, common.Error)
-	GetRoomsByUserId(userId string) ([]dto.UserRoomResponse, common.Error)
+	GetRoomsByUserId(userId string) (dto.UserRoomsOutput, common.Error)
+	// BrowseRooms Used to search public rooms including the number of online members, the user should be member of the browsed workspace
+	BrowseRooms(userId string, input *dto.BrowseRoomInput) (dto.BrowseRoomOutput, common.Error)
+	// UpdateRoomPreference Used to change sender's preferences of the room, the changes are synced into all sender's devices
+	UpdateRoomPreference(sender *model.Client, input *dto.RoomPreferenceInput) common.Error
+	// ReorderRooms Works like UpdateRoomPreference to set the order of sender's rooms
+	ReorderRooms(sender *model.Client, input dto.ReorderRoomsInput) common.Error
+	// SetPresence Used to change sender's presence, the changes will be sent into clients subscribing the sender's presence
+	SetPresence(sender *model.Client, input *dto.SetPresenceInput) common.Error
+	// GetPresences Used to get the presence of the users as seen by the sender
+	GetPresences(sender *model.Client, input *dto.GetPresenceInput) ([]dto.PresenceResponse, common.Error)
+	// SubscribePresence Used to receive presence changes of the users on the sender client, it returns current presence of the users
+	SubscribePresence(sender *model.Client, input *dto.PresenceSubscriptionInput) ([]dto.PresenceResponse, common.Error)
+	UnsubscribePresence(sender *model.Client, input *dto.PresenceSubscriptionInput) common.Error
+	// ActivateClient Used when idle client has activity, the user will be back online
+	ActivateClient(sender *model.Client) common.Error
+	// CheckIdleClients Used to mark the clients inactive for the duration as idle, users are idle when all of their clients on every node are idle
+	CheckIdleClients(duration time.Duration) common.Error
+	GetWorkspacesByUserId(userId string) ([]dto.UserWorkspaceResponse, common.Error)
+	// InviteToWorkspace Used by workspace's admin to add users into the workspace
+	InviteToWorkspace(sender *model.Client, input dto.WorkspaceMemberInput) common.Error
+	// AddWorkspaceMembers Works like InviteToWorkspace without checking sender privilege, the users will join the default rooms
+	AddWorkspaceMembers(input dto.WorkspaceMemberInput) common.Error
+	// LeaveWorkspace Used to leave the workspace and all of its rooms
+	LeaveWorkspace(sender *model.Client, input dto.WorkspaceInput) common.Error
+	// RemoveWorkspaceMember Works like LeaveWorkspace for the user without checking sender privilege
+	RemoveWorkspaceMember(workspaceId string, userId string) common.Error
 	GetRoomMessages(sender *model.Client, request *dto.MessageRequest) ([]dto.MessageResponse, common.Error)
 	GetRoomNotifications(sender *model.Client, request *dto.NotificationRequest) ([]dto.NotificationResponse, common.Error)
 	JoinRoom(sender *model.Client, input dto.RoomInput) common.Error
 	LeaveRoom(sender *model.Client, input dto.RoomInput) common.Error
 	KickOut(sender *model.Client, input dto.MemberRoomInput) common.Error
 	Invite(sender *model.Client, input dto.MemberRoomInput) common.Error
+	// TransferOwnership Used by room's owner to make another member as the owner
+	TransferOwnership(sender *model.Client, input dto.TransferRoomInput) common.Error
+	// UpdateRoom Used by room's admin to update room's information
+	UpdateRoom(sender *model.Client, input *dto.UpdateRoomInput) (dto.RoomResponse, common.Error)
+	// UpdateRoomById Works like UpdateRoom without checking sender privilege, the changes will be broadcast to room's members
+	UpdateRoomById(roomId string, input *dto.UpdateRoomInput) (dto.RoomResponse, common.Error)
+	// SetRoomArchived Used by room's admin to archive or restore the room, archived room is read-only
+	SetRoomArchived(sender *model.Client, input dto.RoomInput, archived bool) common.Error
+	// SetRoomArchivedById Works like SetRoomArchived without checking sender privilege
+	SetRoomArchivedById(roomId string, archived bool) (dto.RoomResponse, common.Error)
+	// MuteUsers Used to prevent room's members from sending message without kicking them out
+	MuteUsers(sender *model.Client, input dto.MuteRoomInput) common.Error
+	UnmuteUsers(sender *model.Client, input dto.MemberRoomInput) common.Error
+	// UpdateRoomSettings Used to change room's moderation settings like slow mode
+	UpdateRoomSettings(sender *model.Client, input dto.RoomSettingsInput) common.Error
 	ClearUsers() common.Error
+	// RefreshRooms Used to reload the rooms after they are changed outside the chat service like REST, the changes are propagated into the other nodes
+	RefreshRooms(roomIds ...string) common.Error
+	// SyncRooms Used to reload the rooms and their connected members from the database, the removed rooms will be removed too
+	SyncRooms(roomIds ...string) common.Error
+	// ReconcileRooms Works like SyncRooms for all rooms, it is used to repair the drift between nodes
+	ReconcileRooms() common.Error
+	// StartSession Used to resume the client's previous session or create new one, the missed events are returned when the session is resumed
+	StartSession(client *model.Client) (dto.SessionResponse, []model.PayloadOutput, common.Error)
+	// RecordEvent Used as model.EventRecorder, the payload is delivered without sequence when it failed to be recorded
+	RecordEvent(payload *model.PayloadOutput, userIds []string) map[string]uint64
+	// ClearLocalClients Works like ClearUsers, but only the clients connected on this node are removed. It is used on cluster mode
+	ClearLocalClients() common.Error
+	// GetOutboundMetrics Used to get queue depth and dropped payloads of the clients outbound queue
+	GetOutboundMetrics() dto.OutboundMetricsResponse
 }
 
-func NewChatService(chatRepository repository.IChatRepository, userService IUserService, roomService IRoomService, roomManager *manager.RoomManager, clientManager *manager.ClientManager) IChatService {
-	return &chatService{
-		repo:          chatRepository,
-		roomManager:   roomManager,
-		clientManager: clientManager,
-		userService:   userService,
-		roomService:   roomService,
+func NewChatService(chatRepository repository.IChatRepository, userService IUserService, roomService IRoomService, workspaceService IWorkspaceService, pushService IPushService, roomManager *manager.RoomManager, clientManager *manager.ClientManager) IChatService {
+	service := &chatService{
+		repo:             chatRepository,
+		roomManager:      roomManager,
+		clientManager:    clientManager,
+		userService:      userService,
+		roomService:      roomService,
+		workspaceService: workspaceService,
+		pushService:      pushService,
+		pushQueue:        make(chan pushJob, constant.PUSH_QUEUE_SIZE),
+	}
+	for i := 0; i < constant.PUSH_WORKER_COUNT; i++ {
+		go service.pushWorker()
 	}
+	return service
+}
+
+// pushJob Used to keep the stored message until it is pushed by the push worker
+type pushJob struct {
+	message *model.Message
+	output  *dto.MessageOutput
 }
 
 type chatService struct {
@@ -48,14 +126,18 @@ type chatService struct {
 	roomManager   *manager.RoomManager
 	clientManager *manager.ClientManager
 
-	userService IUserService
-	roomService IRoomService
+	userService      IUserService
+	roomService      IRoomService
+	workspaceService IWorkspaceService
+	pushService      IPushService
+	pushQueue        chan pushJob // Used to limit the number of messages pushed at the same time
 }
 
 func (c *chatService) ProcessPayload(sender *model.Client, input *model.PayloadInput) model.Payload {
 	return model.Payload{
 		Type:   input.Type,
 		Data:   input.Data,
+		Codec:  sender.Codec,
 		Sender: sender,
 	}
 }
@@ -66,6 +148,31 @@ func (c *chatService) CreateRoom(sender *model.Client, input *dto.CreateRoomInpu
 		return dto.CreateRoomOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 	}
 
+	// Private room is handled as direct message, so it will not be duplicated
+	if input.Private {
+		if len(input.MemberIds) != 1 {
+			return dto.CreateRoomOutput{}, common.NewError(common.ROOM_CREATE_ERROR, constant.MSG_PRIVATE_ROOM_NOT_2_USER)
+		}
+
+		directRoom, cerr := c.OpenDirectRoom(sender, dto.DirectRoomInput{UserId: input.MemberIds[0]})
+		return dto.NewCreateRoomOutputFromUserRoom(&directRoom), cerr
+	}
+
+	if input.WorkspaceId != nil {
+		role, cerr := c.workspaceService.FindMemberRole(*input.WorkspaceId, sender.UserId)
+		if cerr.IsError() {
+			return dto.CreateRoomOutput{}, cerr
+		}
+		if input.IsDefault && role != model.WorkspaceRoleAdmin {
+			return dto.CreateRoomOutput{}, common.NewError(common.AUTH_UNAUTHORIZED, constant.MSG_DEFAULT_ROOM_NOT_ALLOWED)
+		}
+
+		cerr = c.checkWorkspaceMembers(*input.WorkspaceId, input.MemberIds)
+		if cerr.IsError() {
+			return dto.CreateRoomOutput{}, cerr
+		}
+	}
+
 	// Create room on room service
 	output, cerr := c.roomService.CreateRoom(input)
 	if cerr.IsError() {
@@ -73,32 +180,127 @@ func (c *chatService) CreateRoom(sender *model.Client, input *dto.CreateRoomInpu
 	}
 
 	// Add creator as admin
-	role := model.RoomRoleAdmin
-	if input.Private {
-		role = model.RoomRoleUser
-	}
 	userRoomInput := dto.UserRoomAddInput{
-		Users:  dto.NewUserRoles(role, sender.UserId),
+		Users:  dto.NewUserRoles(model.RoomRoleAdmin, sender.UserId),
 		RoomId: output.Id,
 	}
 	c.roomService.AddUsersInRoom(userRoomInput, true)
 
+	// Creator is the owner of the room
+	cerr = c.roomService.TransferRoomOwnership(output.Id, sender.UserId)
+	if cerr.IsError() {
+		return dto.CreateRoomOutput{}, cerr
+	}
+
 	// Handle for room manager
 	creator := c.clientManager.GetClientsByUserId(sender.UserId)
 
 	members := make([]*model.Client, 0, len(input.MemberIds)*2)
 	for _, userId := range input.MemberIds {
 		clients := c.clientManager.GetClientsByUserId(userId)
-		members = append(clients)
+		members = append(members, clients...)
 	}
 	chatRoom := dto.NewChatRoomFromOutput(&output, members...)
+	chatRoom.AddMembers(input.MemberIds...)
+	chatRoom.AddMembers(sender.UserId)
 	// Add creator as admin
-	chatRoom.AddClientsWithSameRole(role, creator...)
+	chatRoom.AddClientsWithSameRole(model.RoomRoleAdmin, creator...)
+	chatRoom.SetOwner(sender.UserId)
 
 	c.roomManager.AddRooms(chatRoom)
+	c.roomManager.PublishMembership(output.Id)
 	return output, common.NoError()
 }
 
+func (c *chatService) CreateRoomWithMembers(input *dto.CreateRoomInput) (dto.CreateRoomOutput, common.Error) {
+	if input.WorkspaceId != nil && !input.Private {
+		cerr := c.checkWorkspaceMembers(*input.WorkspaceId, input.MemberIds)
+		if cerr.IsError() {
+			return dto.CreateRoomOutput{}, cerr
+		}
+	}
+
+	output, cerr := c.roomService.CreateRoom(input)
+	if cerr.IsError() {
+		return dto.CreateRoomOutput{}, cerr
+	}
+	return output, c.RefreshRooms(output.Id)
+}
+
+func (c *chatService) OpenDirectRoom(sender *model.Client, input dto.DirectRoomInput) (dto.UserRoomResponse, common.Error) {
+	if input.UserId == sender.UserId || strutil.IsEmpty(input.UserId) {
+		return dto.UserRoomResponse{}, common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
+	}
+
+	other, cerr := c.userService.FindUserById(input.UserId)
+	if cerr.IsError() {
+		return dto.UserRoomResponse{}, cerr
+	}
+
+	output, created, cerr := c.roomService.OpenDirectRoom(sender.UserId, other.Id)
+	if cerr.IsError() {
+		return dto.UserRoomResponse{}, cerr
+	}
+
+	// Room could be created by another request at the same time
+	if _, err := c.roomManager.GetRoomById(output.Id); err != nil {
+		chatRoom := dto.NewChatRoomFromOutput(&output)
+		chatRoom.AddClientsWithSameRole(model.RoomRoleAdmin, c.clientManager.GetClientsByUserId(sender.UserId)...)
+		chatRoom.AddClientsWithSameRole(model.RoomRoleAdmin, c.clientManager.GetClientsByUserId(other.Id)...)
+		chatRoom.AddMembers(sender.UserId, other.Id)
+		c.roomManager.AddRooms(chatRoom)
+	}
+
+	// Tell the other user about the new direct room, the room name is seen as the sender name
+	if created {
+		c.roomManager.PublishMembership(output.Id)
+		otherResponse := dto.NewDirectRoomResponse(output.Id, sender.Username)
+		payload := model.NewPayloadOutput(model.PayloadOpenDirectRoom, &otherResponse)
+		for _, client := range c.clientManager.GetClientsByUserId(other.Id) {
+			client.SendPayload(&payload)
+		}
+	}
+
+	return dto.NewDirectRoomResponse(output.Id, other.Name), common.NoError()
+}
+
+func (c *chatService) OpenGroupRoom(sender *model.Client, input dto.GroupRoomInput) (dto.UserRoomResponse, common.Error) {
+	// Group room needs at least 3 users including the sender, use direct room instead
+	if len(input.UserIds) < 2 {
+		return dto.UserRoomResponse{}, common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
+	}
+
+	cerr := c.checkGroupUsers(sender, input.UserIds)
+	if cerr.IsError() {
+		return dto.UserRoomResponse{}, cerr
+	}
+
+	memberIds := append([]string{sender.UserId}, input.UserIds...)
+	output, created, cerr := c.roomService.OpenGroupRoom(memberIds)
+	if cerr.IsError() {
+		return dto.UserRoomResponse{}, cerr
+	}
+
+	// Room could be created by another request at the same time
+	if _, err := c.roomManager.GetRoomById(output.Id); err != nil {
+		chatRoom := dto.NewChatRoomFromOutput(&output)
+		for _, userId := range memberIds {
+			chatRoom.AddClientsWithSameRole(model.RoomRoleUser, c.clientManager.GetClientsByUserId(userId)...)
+		}
+		chatRoom.AddMembers(memberIds...)
+		c.roomManager.AddRooms(chatRoom)
+	}
+
+	response := dto.NewGroupRoomResponse(output.Id, output.Name)
+	if created {
+		c.roomManager.PublishMembership(output.Id)
+		payload := model.NewPayloadOutput(model.PayloadOpenGroupRoom, &response)
+		c.sendToUsers(&payload, input.UserIds...)
+	}
+
+	return response, common.NoError()
+}
+
 func (c *chatService) JoinRoom(sender *model.Client, input dto.RoomInput) common.Error {
 	// Check room existences
 	room, err := c.roomManager.GetRoomById(input.RoomId)
@@ -115,6 +317,17 @@ func (c *chatService) JoinRoom(sender *model.Client, input dto.RoomInput) common
 		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_JOIN_PRIVATE_ROOM)
 	}
 
+	metadata := room.Metadata()
+	if metadata.Archived {
+		return common.NewError(common.ROOM_ARCHIVED_ERROR, constant.MSG_ROOM_ARCHIVED)
+	}
+
+	if !strutil.IsEmpty(metadata.WorkspaceId) {
+		if _, cerr := c.workspaceService.FindMemberRole(metadata.WorkspaceId, sender.UserId); cerr.IsError() {
+			return cerr
+		}
+	}
+
 	userRoomInput := dto.UserRoomAddInput{
 		Users:  dto.NewUserRoles(model.RoomRoleUser, sender.UserId),
 		RoomId: input.RoomId,
@@ -127,6 +340,8 @@ func (c *chatService) JoinRoom(sender *model.Client, input dto.RoomInput) common
 
 	clients := c.clientManager.GetClientsByUserId(sender.UserId)
 	room.AddClientsWithSameRole(model.RoomRoleUser, clients...)
+	room.AddMembers(sender.UserId)
+	c.roomManager.PublishMembership(room.Id)
 
 	return common.NoError()
 }
@@ -141,27 +356,49 @@ func (c *chatService) LeaveRoom(sender *model.Client, input dto.RoomInput) commo
 		return common.NewError(common.USER_NOT_ROOM_MEMBER, constant.MSG_USER_NOT_ROOM_MEMBER)
 	}
 
-	if room.Private {
+	metadata := room.Metadata()
+	if room.Private && !metadata.IsGroup {
 		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_LEAVE_FROM_PRIVATE_ROOM)
 	}
 
-	userRoomInput := dto.UserRoomRemoveInput{
-		UserIds: []string{sender.UserId},
-		RoomId:  input.RoomId,
+	// Owner should transfer the ownership first, unless there is no one left
+	count, cerr := c.roomService.FindRoomMemberCountById(room.Id)
+	if cerr.IsError() {
+		return cerr
+	}
+	if metadata.OwnerId == sender.UserId && count > 1 {
+		return common.NewError(common.ROOM_OWNER_LEAVE_ERROR, constant.MSG_OWNER_LEAVE_ROOM)
+	}
+
+	if metadata.IsGroup {
+		cerr = c.roomService.RemoveGroupMembers(room.Id, []string{sender.UserId})
+	} else {
+		userRoomInput := dto.UserRoomRemoveInput{
+			UserIds: []string{sender.UserId},
+			RoomId:  input.RoomId,
+		}
+		cerr = c.roomService.RemoveUsersInRoom(userRoomInput)
 	}
-	cerr := c.roomService.RemoveUsersInRoom(userRoomInput)
 	if cerr.IsError() {
 		return cerr
 	}
+	// Published after the other changes like promotion are done
+	defer c.roomManager.PublishMembership(room.Id)
 
 	// Remove from room manager
 	room.RemoveClientsByUserId(sender.UserId)
 
-	if containers.IsEmpty(room.UserIds()) {
+	// The room is already removed by room service when the sender is the last member
+	if count <= 1 {
 		err = c.roomManager.RemoveRoomById(room.Id)
+		return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 	}
 
-	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	// Group room has no admin
+	if metadata.IsGroup {
+		return common.NoError()
+	}
+	return c.promoteOldestMember(room)
 }
 
 func (c *chatService) KickOut(sender *model.Client, input dto.MemberRoomInput) common.Error {
@@ -179,17 +416,15 @@ func (c *chatService) KickOut(sender *model.Client, input dto.MemberRoomInput) c
 		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_KICK_FROM_PRIVATE_ROOM)
 	}
 
-	users, cerr := c.roomService.FindRoomMembersById(input.RoomId)
-	if cerr.IsError() {
-		return cerr
+	// Owner is never removed, so the ownership could still be transferred
+	if containers.SliceContains(input.UserIds, room.Metadata().OwnerId) {
+		return common.NewError(common.ROOM_OWNER_LEAVE_ERROR, constant.MSG_KICK_ROOM_OWNER)
 	}
 
 	// Check if users is there
-	userIds := containers.ConvertSlice(users, func(current *dto.UserResponse) string {
-		return current.Id
-	})
-	if !containers.SliceContains(userIds, input.UserIds...) {
-		return common.NewError(common.MEMBER_ROOM_NOT_FOUND_ERROR, constant.MSG_MEMBER_ROOM_NOT_FOUND)
+	cerr = c.checkRoomMembers(input.RoomId, input.UserIds)
+	if cerr.IsError() {
+		return cerr
 	}
 
 	userRoomInput := dto.UserRoomRemoveInput{
@@ -205,6 +440,7 @@ func (c *chatService) KickOut(sender *model.Client, input dto.MemberRoomInput) c
 	for _, userId := range input.UserIds {
 		room.RemoveClientsByUserId(userId)
 	}
+	c.roomManager.PublishMembership(room.Id)
 
 	return common.NoError()
 }
@@ -215,6 +451,11 @@ func (c *chatService) Invite(sender *model.Client, input dto.MemberRoomInput) co
 		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 	}
 
+	// Any member could add people into group room
+	if room, err := c.roomManager.GetRoomById(input.RoomId); err == nil && room.Metadata().IsGroup {
+		return c.inviteIntoGroup(sender, room, input.UserIds)
+	}
+
 	room, cerr := c.isAdmin(sender, input.RoomId)
 	if cerr.IsError() {
 		return cerr
@@ -224,6 +465,18 @@ func (c *chatService) Invite(sender *model.Client, input dto.MemberRoomInput) co
 		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_INVITE_TO_PRIVATE_ROOM)
 	}
 
+	metadata := room.Metadata()
+	if metadata.Archived {
+		return common.NewError(common.ROOM_ARCHIVED_ERROR, constant.MSG_ROOM_ARCHIVED)
+	}
+
+	if !strutil.IsEmpty(metadata.WorkspaceId) {
+		cerr = c.checkWorkspaceMembers(metadata.WorkspaceId, input.UserIds)
+		if cerr.IsError() {
+			return cerr
+		}
+	}
+
 	userRoomInput := dto.UserRoomAddInput{
 		Users:  dto.NewUserRoles(model.RoomRoleUser, input.UserIds...),
 		RoomId: input.RoomId,
@@ -240,145 +493,751 @@ func (c *chatService) Invite(sender *model.Client, input dto.MemberRoomInput) co
 		clients := c.clientManager.GetClientsByUserId(userId)
 		room.AddClientsWithSameRole(model.RoomRoleUser, clients...)
 	}
+	room.AddMembers(input.UserIds...)
+	c.roomManager.PublishMembership(room.Id)
 	return common.NoError()
 }
 
-func (c *chatService) GetRoomsByUserId(userId string) ([]dto.UserRoomResponse, common.Error) {
-	return c.roomService.FindUserRoomsByUserId(userId)
+func (c *chatService) TransferOwnership(sender *model.Client, input dto.TransferRoomInput) common.Error {
+	if input.UserId == sender.UserId {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	room, cerr := c.isAdmin(sender, input.RoomId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	if room.Private {
+		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_TRANSFER_PRIVATE_ROOM)
+	}
+
+	// Room without owner could be claimed by any admin
+	if ownerId := room.Metadata().OwnerId; !strutil.IsEmpty(ownerId) && ownerId != sender.UserId {
+		return common.NewError(common.AUTH_UNAUTHORIZED, constant.MSG_AUTH_UNAUTHORIZED)
+	}
+
+	cerr = c.checkRoomMembers(room.Id, []string{input.UserId})
+	if cerr.IsError() {
+		return cerr
+	}
+
+	cerr = c.roomService.TransferRoomOwnership(room.Id, input.UserId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	// Handle room manager
+	room.SetOwner(input.UserId)
+	room.SetRole(input.UserId, model.RoomRoleAdmin)
+	c.roomManager.PublishMembership(room.Id)
+	c.broadcastNotification(room, input.UserId, model.NotifTransferOwner)
+	return common.NoError()
 }
 
-func (c *chatService) GetRoomMessages(sender *model.Client, request *dto.MessageRequest) ([]dto.MessageResponse, common.Error) {
-	cerr := c.checkRoomAndUserExistences(sender, request.RoomId)
+func (c *chatService) UpdateRoom(sender *model.Client, input *dto.UpdateRoomInput) (dto.RoomResponse, common.Error) {
+	// Any member could set the group room's name
+	if room, err := c.roomManager.GetRoomById(input.RoomId); err == nil && room.Metadata().IsGroup {
+		if _, exist := room.GetRoleByUserId(sender.UserId); !exist {
+			return dto.RoomResponse{}, common.NewError(common.USER_NOT_ROOM_MEMBER, constant.MSG_USER_NOT_ROOM_MEMBER)
+		}
+		return c.UpdateRoomById(input.RoomId, input)
+	}
+
+	_, cerr := c.isAdmin(sender, input.RoomId)
 	if cerr.IsError() {
-		return nil, cerr
+		return dto.RoomResponse{}, cerr
 	}
 
-	messages, err := c.repo.FindRoomChats(request)
+	return c.UpdateRoomById(input.RoomId, input)
+}
+
+func (c *chatService) UpdateRoomById(roomId string, input *dto.UpdateRoomInput) (dto.RoomResponse, common.Error) {
+	room, err := c.roomManager.GetRoomById(roomId)
 	if err != nil {
-		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+		return dto.RoomResponse{}, common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
 	}
-	messageResponses := containers.ConvertSlice(messages, dto.NewMessageResponse)
-	return messageResponses, common.NoError()
+
+	response, cerr := c.roomService.UpdateRoomById(roomId, input)
+	if cerr.IsError() {
+		return dto.RoomResponse{}, cerr
+	}
+
+	// Keep the room manager in sync and tell all members
+	dto.UpdateChatRoom(room, &response)
+	c.roomManager.PublishMembership(room.Id)
+	output := model.NewPayloadOutput(model.PayloadRoomUpdated, &response)
+	room.Broadcast(&output)
+
+	return response, common.NoError()
 }
 
-func (c *chatService) GetRoomNotifications(sender *model.Client, request *dto.NotificationRequest) ([]dto.NotificationResponse, common.Error) {
-	cerr := c.checkRoomAndUserExistences(sender, request.RoomId)
+func (c *chatService) SetRoomArchived(sender *model.Client, input dto.RoomInput, archived bool) common.Error {
+	_, cerr := c.isAdmin(sender, input.RoomId)
 	if cerr.IsError() {
-		return nil, cerr
+		return cerr
 	}
 
-	notifs, err := c.repo.FindRoomNotifications(request)
+	_, cerr = c.SetRoomArchivedById(input.RoomId, archived)
+	return cerr
+}
+
+func (c *chatService) SetRoomArchivedById(roomId string, archived bool) (dto.RoomResponse, common.Error) {
+	room, err := c.roomManager.GetRoomById(roomId)
 	if err != nil {
-		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+		return dto.RoomResponse{}, common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
 	}
-	notifsResponses := containers.ConvertSlice(notifs, dto.NewNotificationResponse)
-	return notifsResponses, common.NoError()
-}
 
-func (c *chatService) GetUsersByName(sender *model.Client, name string) (dto.GetUserOutput, common.Error) {
-	// Get all from userService
-	userResponses, err := c.userService.FindUsersByLikelyName(name)
-	if err.IsError() {
-		return dto.GetUserOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	response, cerr := c.roomService.SetRoomArchivedById(roomId, archived)
+	if cerr.IsError() {
+		return dto.RoomResponse{}, cerr
 	}
 
-	// Filter to prevent it returns back the sender name
-	userResponses = containers.SliceFilter(userResponses, func(current *dto.UserResponse) bool {
-		return current.Id != sender.Id
-	})
+	dto.UpdateChatRoom(room, &response)
+	c.roomManager.PublishMembership(room.Id)
+	output := model.NewPayloadOutput(model.PayloadRoomUpdated, &response)
+	room.Broadcast(&output)
 
-	return dto.NewGetUserOutput(userResponses), common.NoError()
+	return response, common.NoError()
 }
 
-func (c *chatService) NewNotification(senderUserId string, input *dto.NotificationInput) (dto.NotificationOutput, common.Error) {
-	// Check room existences
-	_, err := c.roomManager.GetRoomById(input.ReceiverId)
-	if err != nil {
-		return dto.NotificationOutput{}, common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+func (c *chatService) MuteUsers(sender *model.Client, input dto.MuteRoomInput) common.Error {
+	// Prevent the sender in user_ids
+	if containers.SliceContains(input.UserIds, sender.UserId) {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 	}
 
-	notif := dto.NewNotificationFromInput(senderUserId, input)
-	if notif.Type == model.NotifJoinRoom || notif.Type == model.NotifLeaveRoom {
-		_ = c.repo.CreateNotification(&notif)
+	if input.Duration < 0 {
+		return common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
 	}
 
-	output := dto.NewNotificationOutput(&notif)
-	return output, common.NoError()
+	room, cerr := c.isAdmin(sender, input.RoomId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	if room.Private {
+		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_MUTE_IN_PRIVATE_ROOM)
+	}
+
+	cerr = c.checkRoomMembers(input.RoomId, input.UserIds)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	// Only the owner could mute the other admins
+	if ownerId := room.Metadata().OwnerId; ownerId != sender.UserId {
+		if containers.SliceContains(input.UserIds, ownerId) {
+			return common.NewError(common.AUTH_UNAUTHORIZED, constant.MSG_MUTE_ROOM_ADMIN)
+		}
+		roles, cerr := c.roomService.FindRoomMemberRolesById(input.RoomId)
+		if cerr.IsError() {
+			return cerr
+		}
+		for _, member := range roles {
+			if member.Role == model.RoomRoleAdmin && containers.SliceContains(input.UserIds, member.UserId) {
+				return common.NewError(common.AUTH_UNAUTHORIZED, constant.MSG_MUTE_ROOM_ADMIN)
+			}
+		}
+	}
+
+	duration := time.Duration(input.Duration) * time.Second
+	for _, userId := range input.UserIds {
+		if err := c.repo.MuteUser(input.RoomId, userId, duration); err != nil {
+			return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+		}
+	}
+	return common.NoError()
 }
 
-func (c *chatService) NewClient(sender *model.Client) common.Error {
-	roomResponses, cerr := c.roomService.FindUserRoomsByUserId(sender.UserId)
+func (c *chatService) UnmuteUsers(sender *model.Client, input dto.MemberRoomInput) common.Error {
+	room, cerr := c.isAdmin(sender, input.RoomId)
 	if cerr.IsError() {
 		return cerr
 	}
 
-	for _, roomResponse := range roomResponses {
-		chatRoom, err := c.roomManager.GetRoomById(roomResponse.RoomId)
-		if err != nil {
-			log.Println(err)
-			return common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+	if room.Private {
+		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_MUTE_IN_PRIVATE_ROOM)
+	}
+
+	for _, userId := range input.UserIds {
+		if err := c.repo.UnmuteUser(input.RoomId, userId); err != nil {
+			return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 		}
-		chatRoom.AddClient(sender, roomResponse.UserRole)
 	}
+	return common.NoError()
+}
 
-	c.clientManager.AddClients(sender)
+func (c *chatService) UpdateRoomSettings(sender *model.Client, input dto.RoomSettingsInput) common.Error {
+	if input.SlowMode < 0 {
+		return common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
+	}
 
-	// Send list of sender rooms
-	output := model.NewPayloadOutput(model.PayloadGetUserRooms, &roomResponses)
-	sender.SendPayload(&output)
+	room, cerr := c.isAdmin(sender, input.RoomId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	if room.Private {
+		return common.NewError(common.ROOM_IS_PRIVATE_ERROR, constant.MSG_SLOW_MODE_PRIVATE_ROOM)
+	}
 
-	err := c.repo.NewClient(sender)
+	err := c.repo.SetSlowMode(input.RoomId, time.Duration(input.SlowMode)*time.Second)
 	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 }
 
-func (c *chatService) RemoveClient(sender *model.Client) common.Error {
-	roomResponses, cerr := c.roomService.FindUserRoomsByUserId(sender.UserId)
+func (c *chatService) GetRoomsByUserId(userId string) (dto.UserRoomsOutput, common.Error) {
+	rooms, cerr := c.roomService.FindUserRoomsByUserId(userId)
 	if cerr.IsError() {
-		return cerr
+		return dto.UserRoomsOutput{}, cerr
 	}
+	return dto.NewUserRoomsOutput(rooms), common.NoError()
+}
 
-	for _, roomResponse := range roomResponses {
-		chatRoom, err := c.roomManager.GetRoomById(roomResponse.RoomId)
-		if err != nil {
-			log.Println(err)
-			return common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+func (c *chatService) BrowseRooms(userId string, input *dto.BrowseRoomInput) (dto.BrowseRoomOutput, common.Error) {
+	// Workspace's rooms are only visible for its members
+	if !strutil.IsEmpty(input.WorkspaceId) {
+		if _, cerr := c.workspaceService.FindMemberRole(input.WorkspaceId, userId); cerr.IsError() {
+			return dto.BrowseRoomOutput{}, cerr
 		}
-		chatRoom.RemoveClient(sender)
 	}
 
-	c.clientManager.RemoveClientById(sender.Id)
+	output, cerr := c.roomService.BrowseRooms(input)
+	if cerr.IsError() {
+		return output, cerr
+	}
 
-	err := c.repo.RemoveClient(sender)
-	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	for i := range output.Rooms {
+		room, err := c.roomManager.GetRoomById(output.Rooms[i].Id)
+		if err != nil {
+			continue
+		}
+		output.Rooms[i].OnlineCount = room.OnlineCount()
+	}
+	return output, common.NoError()
 }
 
-func (c *chatService) NewMessage(sender *model.Client, input *dto.MessageInput) (dto.MessageOutput, common.Error) {
-	cerr := c.checkRoomAndUserExistences(sender, input.ReceiverId)
+func (c *chatService) UpdateRoomPreference(sender *model.Client, input *dto.RoomPreferenceInput) common.Error {
+	response, cerr := c.roomService.UpdateRoomPreference(sender.UserId, input)
 	if cerr.IsError() {
-		return dto.MessageOutput{}, cerr
+		return cerr
 	}
 
-	// message for storing into database
-	message := dto.NewMessageFromInput(sender, input)
-	if err := c.repo.CreateMessage(&message); err != nil {
-		return dto.MessageOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	preferences := []dto.RoomPreferenceResponse{response}
+	payload := model.NewPayloadOutput(model.PayloadRoomPreferenceUpdated, &preferences)
+	c.sendToUsers(&payload, sender.UserId)
+	return common.NoError()
+}
+
+func (c *chatService) ReorderRooms(sender *model.Client, input dto.ReorderRoomsInput) common.Error {
+	cerr := c.roomService.ReorderRooms(sender.UserId, input.RoomIds)
+	if cerr.IsError() {
+		return cerr
 	}
 
-	return dto.NewMessageOutput(&message), common.NoError()
+	// Get the latest preferences, so the other devices don't need to compute the positions
+	rooms, cerr := c.roomService.FindUserRoomsByUserId(sender.UserId)
+	if cerr.IsError() {
+		return cerr
+	}
+	preferences := containers.ConvertSlice(rooms, func(current *dto.UserRoomResponse) dto.RoomPreferenceResponse {
+		return dto.RoomPreferenceResponse{
+			RoomId:      current.RoomId,
+			Favourite:   current.Favourite,
+			Folder:      current.Folder,
+			Position:    current.Position,
+			NotifLevel:  current.NotifLevel,
+			SnoozeUntil: current.SnoozeUntil,
+		}
+	})
+	payload := model.NewPayloadOutput(model.PayloadRoomPreferenceUpdated, &preferences)
+	c.sendToUsers(&payload, sender.UserId)
+	return common.NoError()
 }
 
-func (c *chatService) ClearUsers() common.Error {
-	err := c.repo.ResetClients()
+func (c *chatService) SetPresence(sender *model.Client, input *dto.SetPresenceInput) common.Error {
+	if !model.IsValidPresenceStatus(input.Status) {
+		return common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_PRESENCE_NOT_FOUND)
+	}
+
+	err := c.repo.SetPresence(sender.UserId, input.Status, input.StatusText, input.ExpiresAt)
 	if err != nil {
 		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 	}
 
+	c.broadcastPresence(sender.UserId)
 	return common.NoError()
 }
 
-// checkRoomAndUserExistences Used to check if the room is exists and if the sender is the room's member
-func (c *chatService) checkRoomAndUserExistences(sender *model.Client, roomId string) common.Error {
-	room, err := c.roomManager.GetRoomById(roomId)
+func (c *chatService) GetPresences(sender *model.Client, input *dto.GetPresenceInput) ([]dto.PresenceResponse, common.Error) {
+	presences, err := c.repo.FindPresences(input.UserIds)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	now := time.Now()
+	responses := containers.ConvertSlice(presences, func(current *model.Presence) dto.PresenceResponse {
+		// User could see its own invisible status
+		presence := current.Public(now)
+		if current.UserId == sender.UserId && current.Status == model.PresenceInvisible {
+			presence.Status = model.PresenceInvisible
+		}
+		return dto.NewPresenceResponse(&presence)
+	})
+	return responses, common.NoError()
+}
+
+func (c *chatService) SubscribePresence(sender *model.Client, input *dto.PresenceSubscriptionInput) ([]dto.PresenceResponse, common.Error) {
+	if !sender.SubscribePresence(constant.PRESENCE_MAX_SUBSCRIPTIONS, input.UserIds...) {
+		return nil, common.NewError(common.PRESENCE_SUBSCRIPTION_LIMIT_ERROR, constant.MSG_PRESENCE_SUBSCRIPTION_LIMIT)
+	}
+	return c.GetPresences(sender, &dto.GetPresenceInput{UserIds: input.UserIds})
+}
+
+func (c *chatService) UnsubscribePresence(sender *model.Client, input *dto.PresenceSubscriptionInput) common.Error {
+	sender.UnsubscribePresence(input.UserIds...)
+	return common.NoError()
+}
+
+func (c *chatService) ActivateClient(sender *model.Client) common.Error {
+	if !sender.SetIdle(false) {
+		return common.NoError()
+	}
+	cerr := c.setClientIdle(sender, false)
+	if cerr.IsError() {
+		// Retried on the next activity
+		sender.SetIdle(true)
+	}
+	return cerr
+}
+
+func (c *chatService) CheckIdleClients(duration time.Duration) common.Error {
+	now := time.Now()
+	for _, client := range c.clientManager.Clients() {
+		// Skip active client and the client that already marked
+		if !client.IsInactive(duration, now) || !client.SetIdle(true) {
+			continue
+		}
+		// The client is retried on the next check, the other clients are still checked
+		if cerr := c.setClientIdle(client, true); cerr.IsError() {
+			client.SetIdle(false)
+			log.Println(cerr.Error())
+		}
+	}
+	return common.NoError()
+}
+
+// setClientIdle Used to mark the client as idle or active on every node, the presence is sent when the user's idle flag is changed
+func (c *chatService) setClientIdle(client *model.Client, idle bool) common.Error {
+	changed, err := c.repo.SetClientIdle(client, idle)
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if changed {
+		c.broadcastPresence(client.UserId)
+	}
+	return common.NoError()
+}
+
+func (c *chatService) GetWorkspacesByUserId(userId string) ([]dto.UserWorkspaceResponse, common.Error) {
+	return c.workspaceService.FindWorkspacesByUserId(userId)
+}
+
+func (c *chatService) InviteToWorkspace(sender *model.Client, input dto.WorkspaceMemberInput) common.Error {
+	role, cerr := c.workspaceService.FindMemberRole(input.WorkspaceId, sender.UserId)
+	if cerr.IsError() {
+		return cerr
+	}
+	if role != model.WorkspaceRoleAdmin {
+		return common.NewError(common.AUTH_UNAUTHORIZED, constant.MSG_AUTH_UNAUTHORIZED)
+	}
+
+	return c.AddWorkspaceMembers(input)
+}
+
+func (c *chatService) AddWorkspaceMembers(input dto.WorkspaceMemberInput) common.Error {
+	if strutil.IsEmpty(string(input.Role)) {
+		input.Role = model.WorkspaceRoleMember
+	} else if input.Role != model.WorkspaceRoleMember && input.Role != model.WorkspaceRoleAdmin {
+		return common.NewError(common.WORKSPACE_ROLE_NOT_FOUND_ERROR, constant.MSG_WORKSPACE_ROLE_NOT_FOUND)
+	}
+
+	for _, userId := range input.UserIds {
+		if _, cerr := c.userService.FindUserById(userId); cerr.IsError() {
+			return cerr
+		}
+	}
+
+	// Duplication handled by the repository
+	roomIds, cerr := c.workspaceService.AddWorkspaceMembers(input.WorkspaceId, input.UserIds, input.Role)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	// Handle room manager for the default rooms
+	for _, roomId := range roomIds {
+		room, err := c.roomManager.GetRoomById(roomId)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		for _, userId := range input.UserIds {
+			room.AddMembers(userId)
+			if _, exist := room.GetRoleByUserId(userId); exist {
+				continue
+			}
+			room.AddClientsWithSameRole(model.RoomRoleUser, c.clientManager.GetClientsByUserId(userId)...)
+		}
+	}
+	c.roomManager.PublishMembership(roomIds...)
+
+	// Tell the users about the new workspace
+	workspace, cerr := c.workspaceService.FindWorkspaceById(input.WorkspaceId)
+	if cerr.IsError() {
+		return cerr
+	}
+	response := dto.UserWorkspaceResponse{WorkspaceResponse: *workspace, Role: input.Role}
+	payload := model.NewPayloadOutput(model.PayloadWorkspaceAdded, &response)
+	c.sendToUsers(&payload, input.UserIds...)
+	return common.NoError()
+}
+
+func (c *chatService) LeaveWorkspace(sender *model.Client, input dto.WorkspaceInput) common.Error {
+	_, cerr := c.workspaceService.FindMemberRole(input.WorkspaceId, sender.UserId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	return c.RemoveWorkspaceMember(input.WorkspaceId, sender.UserId)
+}
+
+func (c *chatService) RemoveWorkspaceMember(workspaceId string, userId string) common.Error {
+	workspace, cerr := c.workspaceService.FindWorkspaceById(workspaceId)
+	if cerr.IsError() {
+		return cerr
+	}
+	if workspace.OwnerId == userId {
+		return common.NewError(common.WORKSPACE_OWNER_LEAVE_ERROR, constant.MSG_OWNER_LEAVE_WORKSPACE)
+	}
+
+	roomIds, cerr := c.workspaceService.RemoveWorkspaceMember(workspaceId, userId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	// Handle room manager, the room's ownership is already released by the workspace service
+	for _, roomId := range roomIds {
+		room, err := c.roomManager.GetRoomById(roomId)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		room.RemoveClientsByUserId(userId)
+		room.ReleaseOwner(userId)
+		if cerr = c.promoteOldestMember(room); cerr.IsError() {
+			log.Println(cerr.Error())
+		}
+	}
+	c.roomManager.PublishMembership(roomIds...)
+	return common.NoError()
+}
+
+func (c *chatService) GetRoomMessages(sender *model.Client, request *dto.MessageRequest) ([]dto.MessageResponse, common.Error) {
+	cerr := c.checkRoomAndUserExistences(sender, request.RoomId)
+	if cerr.IsError() {
+		return nil, cerr
+	}
+
+	request.Normalize()
+	messages, err := c.repo.FindRoomChats(request)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	messageResponses := containers.ConvertSlice(messages, dto.NewMessageResponse)
+	return messageResponses, common.NoError()
+}
+
+func (c *chatService) GetRoomNotifications(sender *model.Client, request *dto.NotificationRequest) ([]dto.NotificationResponse, common.Error) {
+	cerr := c.checkRoomAndUserExistences(sender, request.RoomId)
+	if cerr.IsError() {
+		return nil, cerr
+	}
+
+	notifs, err := c.repo.FindRoomNotifications(request)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	notifsResponses := containers.ConvertSlice(notifs, dto.NewNotificationResponse)
+	return notifsResponses, common.NoError()
+}
+
+func (c *chatService) GetUsersByName(sender *model.Client, name string) (dto.GetUserOutput, common.Error) {
+	// Get all from userService
+	userResponses, err := c.userService.FindUsersByLikelyName(name)
+	if err.IsError() {
+		return dto.GetUserOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	// Filter to prevent it returns back the sender name
+	userResponses = containers.SliceFilter(userResponses, func(current *dto.UserResponse) bool {
+		return current.Id != sender.Id
+	})
+
+	return dto.NewGetUserOutput(userResponses), common.NoError()
+}
+
+func (c *chatService) NewNotification(senderUserId string, input *dto.NotificationInput) (dto.NotificationOutput, common.Error) {
+	// Check room existences
+	room, err := c.roomManager.GetRoomById(input.ReceiverId)
+	if err != nil {
+		return dto.NotificationOutput{}, common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+	}
+
+	// Nobody could type on read-only room
+	if input.Type == model.NotifTyping && room.Metadata().Archived {
+		return dto.NotificationOutput{}, common.NewError(common.ROOM_ARCHIVED_ERROR, constant.MSG_ROOM_ARCHIVED)
+	}
+
+	notif := dto.NewNotificationFromInput(senderUserId, input)
+	if !notif.Type.IsTyping() {
+		_ = c.repo.CreateNotification(&notif)
+	}
+
+	output := dto.NewNotificationOutput(&notif)
+	return output, common.NoError()
+}
+
+func (c *chatService) NewClient(sender *model.Client) common.Error {
+	roomResponses, cerr := c.roomService.FindUserRoomsByUserId(sender.UserId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	for _, roomResponse := range roomResponses {
+		chatRoom, err := c.roomManager.GetRoomById(roomResponse.RoomId)
+		if err != nil {
+			log.Println(err)
+			return common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+		}
+		chatRoom.AddClient(sender, roomResponse.UserRole)
+	}
+
+	c.clientManager.AddClients(sender)
+
+	// Send list of sender rooms
+	userRooms := dto.NewUserRoomsOutput(roomResponses)
+	output := model.NewPayloadOutput(model.PayloadGetUserRooms, &userRooms)
+	sender.SendPayload(&output)
+
+	// New connection is an activity of the idle user
+	idleChanged, err := c.repo.NewClient(sender)
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	// User just become online
+	clients := c.clientManager.GetUniqueClientByUserId(sender)
+	if containers.IsEmpty(clients) || idleChanged {
+		c.broadcastPresence(sender.UserId)
+	}
+	return common.NoError()
+}
+
+func (c *chatService) RemoveClient(sender *model.Client) common.Error {
+	roomResponses, cerr := c.roomService.FindUserRoomsByUserId(sender.UserId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	for _, roomResponse := range roomResponses {
+		chatRoom, err := c.roomManager.GetRoomById(roomResponse.RoomId)
+		if err != nil {
+			log.Println(err)
+			return common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+		}
+		chatRoom.RemoveClient(sender)
+	}
+
+	c.clientManager.RemoveClientById(sender.Id)
+
+	// The other clients could be all idle
+	idleChanged, err := c.repo.RemoveClient(sender)
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	// The session could be resumed until expired since the client is disconnected
+	if !strutil.IsEmpty(sender.SessionId) {
+		if err = c.repo.SaveSession(sender.SessionId, sender.UserId, constant.SESSION_EXPIRATION_DURATION); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// User just become offline
+	if containers.IsEmpty(c.clientManager.GetClientsByUserId(sender.UserId)) || idleChanged {
+		c.broadcastPresence(sender.UserId)
+	}
+	return common.NoError()
+}
+
+func (c *chatService) NewMessage(sender *model.Client, input *dto.MessageInput) (dto.MessageOutput, common.Error) {
+	cerr := c.checkRoomAndUserExistences(sender, input.ReceiverId)
+	if cerr.IsError() {
+		return dto.MessageOutput{}, cerr
+	}
+
+	slowModeTaken, cerr := c.checkModeration(sender, input.ReceiverId)
+	if cerr.IsError() {
+		return dto.MessageOutput{}, cerr
+	}
+
+	// message for storing into database
+	message := dto.NewMessageFromInput(sender, input)
+	if err := c.repo.CreateMessage(&message); err != nil {
+		// The message is not sent, so the user could send it again without waiting
+		if slowModeTaken {
+			if err = c.repo.ReleaseSlowModeTurn(input.ReceiverId, sender.UserId); err != nil {
+				log.Println(err)
+			}
+		}
+		return dto.MessageOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	output := dto.NewMessageOutput(&message)
+	// Push is best effort, so the message is not pushed rather than blocking the sender
+	select {
+	case c.pushQueue <- pushJob{message: &message, output: &output}:
+	default:
+		log.Println("Push queue is full, message ", message.Id, " is not pushed")
+	}
+	return output, common.NoError()
+}
+
+func (c *chatService) GetOutboundMetrics() dto.OutboundMetricsResponse {
+	metrics := c.clientManager.OutboundMetrics()
+	return dto.NewOutboundMetricsResponse(&metrics)
+}
+
+func (c *chatService) ClearUsers() common.Error {
+	err := c.repo.ResetClients()
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	return common.NoError()
+}
+
+func (c *chatService) RefreshRooms(roomIds ...string) common.Error {
+	cerr := c.SyncRooms(roomIds...)
+	c.roomManager.PublishMembership(roomIds...)
+	return cerr
+}
+
+func (c *chatService) SyncRooms(roomIds ...string) common.Error {
+	for _, roomId := range roomIds {
+		room, cerr := c.roomService.FindRoomById(roomId)
+		if cerr.IsError() {
+			return cerr
+		}
+
+		// Room is already removed
+		if strutil.IsEmpty(room.Id) {
+			_ = c.roomManager.RemoveRoomById(roomId)
+			continue
+		}
+
+		if cerr = c.syncRoom(room); cerr.IsError() {
+			return cerr
+		}
+	}
+	return common.NoError()
+}
+
+func (c *chatService) ReconcileRooms() common.Error {
+	// Taken before the query, so the rooms created while reconciling are never removed
+	loaded := c.roomManager.Rooms()
+
+	rooms, cerr := c.roomService.FindRooms(true)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	existing := make(map[string]bool, len(rooms))
+	for i := range rooms {
+		existing[rooms[i].Id] = true
+		if cerr = c.syncRoom(&rooms[i]); cerr.IsError() {
+			return cerr
+		}
+	}
+
+	for _, chatRoom := range loaded {
+		if !existing[chatRoom.Id] {
+			_ = c.roomManager.RemoveRoomById(chatRoom.Id)
+		}
+	}
+	return common.NoError()
+}
+
+func (c *chatService) StartSession(client *model.Client) (dto.SessionResponse, []model.PayloadOutput, common.Error) {
+	if !strutil.IsEmpty(client.ResumeSessionId) {
+		userId, err := c.repo.FindSessionUserId(client.ResumeSessionId)
+		if err != nil {
+			return dto.SessionResponse{}, nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+		}
+
+		// The session is only resumed by the same user
+		if userId == client.UserId {
+			events, resumed, cerr := c.findMissedEvents(client.UserId, client.ResumeSeq)
+			if cerr.IsError() {
+				return dto.SessionResponse{}, nil, cerr
+			}
+			if resumed {
+				seq := client.ResumeSeq
+				if len(events) != 0 {
+					seq = events[len(events)-1].Seq
+				}
+				client.SessionId = client.ResumeSessionId
+				client.SetReplaySeq(seq)
+				if err = c.repo.SaveSession(client.SessionId, client.UserId, constant.SESSION_EXPIRATION_DURATION); err != nil {
+					return dto.SessionResponse{}, nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+				}
+				return dto.NewSessionResponse(client.SessionId, seq, true), events, common.NoError()
+			}
+		}
+	}
+
+	seq, err := c.repo.GetEventSeq(client.UserId)
+	if err != nil {
+		return dto.SessionResponse{}, nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	client.SessionId = uuid.NewString()
+	if err = c.repo.SaveSession(client.SessionId, client.UserId, constant.SESSION_EXPIRATION_DURATION); err != nil {
+		return dto.SessionResponse{}, nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	return dto.NewSessionResponse(client.SessionId, seq, false), nil, common.NoError()
+}
+
+func (c *chatService) RecordEvent(payload *model.PayloadOutput, userIds []string) map[string]uint64 {
+	seqs, err := c.repo.RecordEvent(payload, userIds)
+	if err != nil {
+		log.Println("Record Event Error: ", err)
+		return nil
+	}
+	return seqs
+}
+
+func (c *chatService) ClearLocalClients() common.Error {
+	for _, client := range c.clientManager.Clients() {
+		if _, err := c.repo.RemoveClient(client); err != nil {
+			return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+		}
+	}
+	return common.NoError()
+}
+
+// checkRoomAndUserExistences Used to check if the room is exists and if the sender is the room's member
+func (c *chatService) checkRoomAndUserExistences(sender *model.Client, roomId string) common.Error {
+	room, err := c.roomManager.GetRoomById(roomId)
 	if err != nil {
 		return common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
 	}
@@ -389,6 +1248,278 @@ func (c *chatService) checkRoomAndUserExistences(sender *model.Client, roomId st
 	return common.NoError()
 }
 
+// checkModeration Used to check if the room is archived, the sender is muted or still waiting for slow mode on the room, room's admin is not affected by slow mode.
+// It returns true when the slow mode turn is taken, so it could be released when the message is not stored
+func (c *chatService) checkModeration(sender *model.Client, roomId string) (bool, common.Error) {
+	room, err := c.roomManager.GetRoomById(roomId)
+	if err != nil {
+		return false, common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+	}
+	if room.Metadata().Archived {
+		return false, common.NewError(common.ROOM_ARCHIVED_ERROR, constant.MSG_ROOM_ARCHIVED)
+	}
+
+	muted, err := c.repo.IsUserMuted(roomId, sender.UserId)
+	if err != nil {
+		return false, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if muted {
+		return false, common.NewError(common.CHAT_USER_MUTED_ERROR, constant.MSG_USER_MUTED)
+	}
+
+	if role, _ := room.GetRoleByUserId(sender.UserId); role == model.RoomRoleAdmin {
+		return false, common.NoError()
+	}
+
+	slowMode, err := c.repo.GetSlowMode(roomId)
+	if err != nil {
+		return false, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if slowMode <= 0 {
+		return false, common.NoError()
+	}
+
+	allowed, err := c.repo.TakeSlowModeTurn(roomId, sender.UserId, slowMode)
+	if err != nil {
+		return false, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if !allowed {
+		return false, common.NewError(common.CHAT_SLOW_MODE_ERROR, constant.MSG_SLOW_MODE_ACTIVE)
+	}
+	return true, common.NoError()
+}
+
+// inviteIntoGroup Used to add users into group room by any of its members
+func (c *chatService) inviteIntoGroup(sender *model.Client, room *model.ChatRoom, userIds []string) common.Error {
+	if _, exist := room.GetRoleByUserId(sender.UserId); !exist {
+		return common.NewError(common.USER_NOT_ROOM_MEMBER, constant.MSG_USER_NOT_ROOM_MEMBER)
+	}
+
+	if room.Metadata().Archived {
+		return common.NewError(common.ROOM_ARCHIVED_ERROR, constant.MSG_ROOM_ARCHIVED)
+	}
+
+	cerr := c.checkGroupUsers(sender, userIds)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	cerr = c.roomService.AddGroupMembers(room.Id, userIds)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	// Handle room manager
+	for _, userId := range userIds {
+		clients := c.clientManager.GetClientsByUserId(userId)
+		room.AddClientsWithSameRole(model.RoomRoleUser, clients...)
+	}
+	room.AddMembers(userIds...)
+	c.roomManager.PublishMembership(room.Id)
+
+	response := dto.NewGroupRoomResponse(room.Id, room.Metadata().Name)
+	payload := model.NewPayloadOutput(model.PayloadOpenGroupRoom, &response)
+	c.sendToUsers(&payload, userIds...)
+	return common.NoError()
+}
+
+// checkGroupUsers Used to check if the users exist and are not duplicated, the sender should not be included
+func (c *chatService) checkGroupUsers(sender *model.Client, userIds []string) common.Error {
+	checked := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		if userId == sender.UserId || containers.SliceContains(checked, userId) {
+			return common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
+		}
+
+		_, cerr := c.userService.FindUserById(userId)
+		if cerr.IsError() {
+			return cerr
+		}
+		checked = append(checked, userId)
+	}
+	return common.NoError()
+}
+
+// checkWorkspaceMembers Used to check if all the userIds are the workspace's member
+func (c *chatService) checkWorkspaceMembers(workspaceId string, userIds []string) common.Error {
+	for _, userId := range userIds {
+		_, cerr := c.workspaceService.FindMemberRole(workspaceId, userId)
+		if cerr.ErrorCode == common.WORKSPACE_NOT_MEMBER_ERROR {
+			return common.NewError(common.WORKSPACE_NOT_MEMBER_ERROR, constant.MSG_USER_NOT_WORKSPACE_MEMBER)
+		}
+		if cerr.IsError() {
+			return cerr
+		}
+	}
+	return common.NoError()
+}
+
+// pushWorker Used to push the queued messages one by one
+func (c *chatService) pushWorker() {
+	for job := range c.pushQueue {
+		c.pushMessage(job.message, job.output)
+	}
+}
+
+// pushMessage Used to push the message into offline members based on their notification preferences
+func (c *chatService) pushMessage(message *model.Message, output *dto.MessageOutput) {
+	receiverIds, cerr := c.roomService.FindPushReceiverIds(message)
+	if cerr.IsError() {
+		log.Println(cerr.Error())
+		return
+	}
+
+	// Online users already get the message from the websocket
+	receiverIds = containers.SliceFilter(receiverIds, func(current *string) bool {
+		return containers.IsEmpty(c.clientManager.GetClientsByUserId(*current))
+	})
+	if cerr = c.pushService.PushMessage(receiverIds, output); cerr.IsError() {
+		log.Println(cerr.Error())
+	}
+}
+
+// broadcastPresence Used to send user's presence into all clients subscribing it, user's own clients get the actual presence
+func (c *chatService) broadcastPresence(userId string) {
+	presences, err := c.repo.FindPresences([]string{userId})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// User without presence has nothing to broadcast
+	if containers.IsEmpty(presences) {
+		return
+	}
+
+	ownResponse := dto.NewPresenceResponse(&presences[0])
+	ownPayload := model.NewPayloadOutput(model.PayloadPresence, &ownResponse)
+	ownPayload.CoalesceKey = model.PayloadPresence + ":" + userId
+	ownPayload.Feature = model.FeaturePresence
+
+	public := presences[0].Public(time.Now())
+	response := dto.NewPresenceResponse(&public)
+	payload := model.NewPayloadOutput(model.PayloadPresence, &response)
+	payload.CoalesceKey = ownPayload.CoalesceKey
+	payload.Feature = ownPayload.Feature
+
+	c.clientManager.SendPresence(userId, &ownPayload, &payload)
+}
+
+// sendToUsers Used to send payload into all clients of the users
+func (c *chatService) sendToUsers(payload *model.PayloadOutput, userIds ...string) {
+	c.clientManager.SendToUsers(payload, userIds...)
+}
+
+// findMissedEvents Used to get the user's events after the sequence, it returns false when some of the events are not kept anymore
+func (c *chatService) findMissedEvents(userId string, seq uint64) ([]model.PayloadOutput, bool, common.Error) {
+	current, err := c.repo.GetEventSeq(userId)
+	if err != nil {
+		return nil, false, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if seq > current {
+		return nil, false, common.NoError()
+	}
+	if seq == current {
+		return nil, true, common.NoError()
+	}
+
+	events, err := c.repo.FindEventsAfter(userId, seq)
+	if err != nil {
+		return nil, false, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	// The next event is already trimmed or expired
+	if len(events) == 0 || events[0].Seq != seq+1 {
+		return nil, false, common.NoError()
+	}
+	return events, true, common.NoError()
+}
+
+// syncRoom Used to make the ChatRoom same with the stored room, the room will be created when it doesn't exist.
+// Only the connected clients of the members are kept on the room with their stored role
+func (c *chatService) syncRoom(room *dto.RoomResponse) common.Error {
+	members, cerr := c.roomService.FindRoomMemberRolesById(room.Id)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	chatRoom, err := c.roomManager.GetRoomById(room.Id)
+	if err != nil {
+		if room.Private {
+			chatRoom = model.NewPrivateChatRoom(room.Id, room.Name, room.Description, room.InviteOnly)
+		} else {
+			chatRoom = model.NewChatRoom(room.Id, room.Name, room.Description, room.InviteOnly)
+		}
+		c.roomManager.AddRooms(chatRoom)
+	}
+	dto.UpdateChatRoom(chatRoom, room)
+
+	roles := make(map[string]model.RoomRole, len(members))
+	for _, member := range members {
+		roles[member.UserId] = member.Role
+	}
+	chatRoom.SetMembers(containers.MapKeys(roles)...)
+
+	// Remove the clients of the users that is not a member anymore
+	for _, client := range chatRoom.Clients() {
+		if _, exist := roles[client.UserId]; !exist {
+			chatRoom.RemoveClient(client)
+		}
+	}
+
+	for userId, role := range roles {
+		for _, client := range c.clientManager.GetClientsByUserId(userId) {
+			if !chatRoom.IsClientExist(client) {
+				chatRoom.AddClient(client, role)
+			}
+		}
+		chatRoom.SetRole(userId, role)
+	}
+	return common.NoError()
+}
+
+// promoteOldestMember Used to make sure the room still has admin after the member left
+func (c *chatService) promoteOldestMember(room *model.ChatRoom) common.Error {
+	userId, cerr := c.roomService.PromoteOldestMember(room.Id)
+	if cerr.IsError() || strutil.IsEmpty(userId) {
+		return cerr
+	}
+
+	room.SetRole(userId, model.RoomRoleAdmin)
+	c.broadcastNotification(room, userId, model.NotifPromoteAdmin)
+	return common.NoError()
+}
+
+// broadcastNotification Used to create notification by the service itself and send it into all room's members
+func (c *chatService) broadcastNotification(room *model.ChatRoom, senderUserId string, types model.NotificationType) {
+	notifInput := dto.NotificationInput{
+		Type:       types,
+		ReceiverId: room.Id,
+	}
+	output, cerr := c.NewNotification(senderUserId, &notifInput)
+	if cerr.IsError() {
+		log.Println(cerr.Error())
+		return
+	}
+
+	payload := model.NewPayloadOutput(model.PayloadNotification, &output)
+	room.Broadcast(&payload)
+}
+
+// checkRoomMembers Used to check if all the userIds are the room's member
+func (c *chatService) checkRoomMembers(roomId string, userIds []string) common.Error {
+	users, cerr := c.roomService.FindRoomMembersById(roomId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	memberIds := containers.ConvertSlice(users, func(current *dto.UserResponse) string {
+		return current.Id
+	})
+	if !containers.SliceContains(memberIds, userIds...) {
+		return common.NewError(common.MEMBER_ROOM_NOT_FOUND_ERROR, constant.MSG_MEMBER_ROOM_NOT_FOUND)
+	}
+	return common.NoError()
+}
+
 // isAdmin Used to check if the sender is Admin on the room, it will return the ChatRoom and error based on where the error occurred, the error can occure on
 func (c *chatService) isAdmin(sender *model.Client, roomId string) (*model.ChatRoom, common.Error) {
 	// Get room existence
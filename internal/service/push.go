@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chatto/internal/config"
+	"chatto/internal/constant"
+	"chatto/internal/dto"
+	"chatto/internal/model/common"
+	"chatto/internal/util/containers"
+	"chatto/internal/util/strutil"
+)
+
+const pushRequestTimeout = time.Second * 5
+
+type IPushService interface {
+	// PushMessage Used to notify the users about new message outside the websocket, like mobile push or webhook
+	PushMessage(userIds []string, message *dto.MessageOutput) common.Error
+}
+
+// NewPushService Used to create webhook push service, the push is disabled when the webhook url is not set
+func NewPushService(conf *config.AppConfig) IPushService {
+	return &webhookPushService{
+		url:    conf.PushWebhookURL,
+		client: &http.Client{Timeout: pushRequestTimeout},
+	}
+}
+
+type webhookPushService struct {
+	url    string
+	client *http.Client
+}
+
+func (w *webhookPushService) PushMessage(userIds []string, message *dto.MessageOutput) common.Error {
+	if strutil.IsEmpty(w.url) || containers.IsEmpty(userIds) {
+		return common.NoError()
+	}
+
+	body, err := json.Marshal(dto.NewPushMessageOutput(userIds, message))
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, fmt.Sprint("push webhook responded with status ", resp.StatusCode))
+	}
+	return common.NoError()
+}
@@ -1,24 +1,59 @@
 package service
 
 import (
+	"errors"
+	"time"
+
 	"chatto/internal/constant"
 	"chatto/internal/dto"
 	"chatto/internal/model"
 	"chatto/internal/model/common"
 	"chatto/internal/repository"
 	"chatto/internal/util/containers"
+	"chatto/internal/util/strutil"
 )
 
 type IRoomService interface {
+	// CreateRoom Used to create room with the members, private room is opened as direct room between exactly 2 members
 	CreateRoom(room *dto.CreateRoomInput) (dto.CreateRoomOutput, common.Error)
-	FindRooms() ([]dto.RoomResponse, common.Error)
+	// OpenDirectRoom Used to get private room between two users or create it when it is not exists yet, the bool will be true when the room is created
+	OpenDirectRoom(userId string, otherUserId string) (dto.CreateRoomOutput, bool, common.Error)
+	// OpenGroupRoom Works like OpenDirectRoom for group room, the group is deduplicated by the whole members
+	OpenGroupRoom(userIds []string) (dto.CreateRoomOutput, bool, common.Error)
+	// AddGroupMembers Used to add users into group room, the members should not exceed the limit or same with another group room
+	AddGroupMembers(roomId string, userIds []string) common.Error
+	// RemoveGroupMembers Used to remove users from group room, the room will be removed when there are no members left
+	RemoveGroupMembers(roomId string, userIds []string) common.Error
+	// FindRooms Used to get all rooms, archived rooms are only included when includeArchived is true
+	FindRooms(includeArchived bool) ([]dto.RoomResponse, common.Error)
 	FindRoomById(id string) (*dto.RoomResponse, common.Error)
+	// BrowseRooms Used to search public rooms with their member count
+	BrowseRooms(input *dto.BrowseRoomInput) (dto.BrowseRoomOutput, common.Error)
+	// UpdateRoomById Used to update room's information based on non-nil fields of the input
+	UpdateRoomById(id string, input *dto.UpdateRoomInput) (dto.RoomResponse, common.Error)
+	// SetRoomArchivedById Used to archive or restore the room
+	SetRoomArchivedById(id string, archived bool) (dto.RoomResponse, common.Error)
 	// FindUserRoomsByUserId Used to get all UserRooms by the user
 	FindUserRoomsByUserId(userId string) ([]dto.UserRoomResponse, common.Error)
+	// UpdateRoomPreference Used to change user's preferences of the room, the user should be room's member
+	UpdateRoomPreference(userId string, input *dto.RoomPreferenceInput) (dto.RoomPreferenceResponse, common.Error)
+	// ReorderRooms Used to set user's room order, rooms that the user is not member of are ignored
+	ReorderRooms(userId string, roomIds []string) common.Error
 	// FindRoomsByUserId Used to get all Rooms by the user
 	FindRoomsByUserId(userId string) ([]dto.RoomResponse, common.Error)
 	// FindRoomMembersById Used to get all users on room
 	FindRoomMembersById(roomId string) ([]dto.UserResponse, common.Error)
+	// FindPushReceiverIds Used to get the members that should be notified about the message based on their notification preferences, the sender is excluded
+	FindPushReceiverIds(message *model.Message) ([]string, common.Error)
+	// FindRoomMemberRolesById Used to get all room's member ids with their role
+	FindRoomMemberRolesById(roomId string) ([]dto.UserWithRole, common.Error)
+	// FindRoomMemberCountById Used to get the number of room's members
+	FindRoomMemberCountById(roomId string) (int64, common.Error)
+	// TransferRoomOwnership Used to set the user as room's owner, the new owner will be promoted as admin
+	TransferRoomOwnership(roomId string, userId string) common.Error
+	// PromoteOldestMember Used to promote the longest-standing member as admin when the room has no admin left.
+	// It returns the promoted user id or empty string when there is no need to promote
+	PromoteOldestMember(roomId string) (string, common.Error)
 	// AddUsersInRoom Used to add user into room, This function should check either the room is exists on IRoomService and user on IUserService
 	AddUsersInRoom(input dto.UserRoomAddInput, allowPrivate bool) common.Error
 	// RemoveUsersInRoom Used to remove user from room, Room should be removed when there are no users left
@@ -40,11 +75,16 @@ type roomService struct {
 }
 
 func (r roomService) CreateRoom(input *dto.CreateRoomInput) (dto.CreateRoomOutput, common.Error) {
-	room := dto.NewRoomFromCreateInput(input)
-	if room.Private && len(input.MemberIds) != 1 {
-		return dto.CreateRoomOutput{}, common.NewError(common.ROOM_CREATE_ERROR, constant.MSG_PRIVATE_ROOM_NOT_2_USER)
+	// Private room should have the direct key, so it is deduplicated with the room opened by the members
+	if input.Private {
+		if len(input.MemberIds) != 2 || input.MemberIds[0] == input.MemberIds[1] {
+			return dto.CreateRoomOutput{}, common.NewError(common.ROOM_CREATE_ERROR, constant.MSG_PRIVATE_ROOM_NOT_2_USER)
+		}
+		output, _, cerr := r.OpenDirectRoom(input.MemberIds[0], input.MemberIds[1])
+		return output, cerr
 	}
 
+	room := dto.NewRoomFromCreateInput(input)
 	err := r.roomRepo.CreateRoom(room)
 	if err != nil {
 		return dto.CreateRoomOutput{}, common.NewError(common.ROOM_CREATE_ERROR, constant.MSG_ROOM_CREATION_FAILED)
@@ -64,18 +104,169 @@ func (r roomService) CreateRoom(input *dto.CreateRoomInput) (dto.CreateRoomOutpu
 	return dto.NewCreateRoomOutput(room), common.NewConditionalError(err, common.ROOM_CREATE_ERROR, constant.MSG_ROOM_CREATION_FAILED)
 }
 
-func (r roomService) FindRooms() ([]dto.RoomResponse, common.Error) {
-	rooms, err := r.roomRepo.FindRooms()
+func (r roomService) OpenDirectRoom(userId string, otherUserId string) (dto.CreateRoomOutput, bool, common.Error) {
+	// Both users are equal on direct room
+	room := dto.NewDirectRoom(model.NewDirectKey(userId, otherUserId))
+	return r.openPrivateRoom(room, model.RoomRoleAdmin, userId, otherUserId)
+}
+
+func (r roomService) OpenGroupRoom(userIds []string) (dto.CreateRoomOutput, bool, common.Error) {
+	if len(userIds) > constant.GROUP_ROOM_MAX_MEMBERS {
+		return dto.CreateRoomOutput{}, false, common.NewError(common.ROOM_MEMBER_LIMIT_ERROR, constant.MSG_GROUP_ROOM_MEMBER_LIMIT)
+	}
+
+	// Group room has no admin
+	room := dto.NewGroupRoom(model.NewGroupKey(userIds...))
+	return r.openPrivateRoom(room, model.RoomRoleUser, userIds...)
+}
+
+func (r roomService) AddGroupMembers(roomId string, userIds []string) common.Error {
+	memberIds, cerr := r.groupMemberIds(roomId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	// Filter users that are already member
+	userIds = containers.SliceFilter(userIds, func(current *string) bool {
+		return !containers.SliceContains(memberIds, *current)
+	})
+	memberIds = append(memberIds, userIds...)
+	if len(memberIds) > constant.GROUP_ROOM_MAX_MEMBERS {
+		return common.NewError(common.ROOM_MEMBER_LIMIT_ERROR, constant.MSG_GROUP_ROOM_MEMBER_LIMIT)
+	}
+
+	added := containers.ConvertSlice(userIds, func(current *string) model.UserRoom {
+		return model.NewUserRoom(roomId, *current, model.RoomRoleUser)
+	})
+	key := model.NewGroupKey(memberIds...)
+	err := r.roomRepo.UpdateGroupMembers(roomId, &key, added, nil)
+	// The unique key is violated when there is another group with the same members
+	if errors.Is(err, repository.ErrDuplicatedKey) {
+		return common.NewError(common.ROOM_DUPLICATE_ERROR, constant.MSG_GROUP_ROOM_EXISTS)
+	}
+	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (r roomService) RemoveGroupMembers(roomId string, userIds []string) common.Error {
+	memberIds, cerr := r.groupMemberIds(roomId)
+	if cerr.IsError() {
+		return cerr
+	}
+
+	memberIds = containers.SliceFilter(memberIds, func(current *string) bool {
+		return !containers.SliceContains(userIds, *current)
+	})
+	if containers.IsEmpty(memberIds) {
+		return r.RemoveUsersInRoom(dto.UserRoomRemoveInput{RoomId: roomId, UserIds: userIds})
+	}
+
+	key := model.NewGroupKey(memberIds...)
+	err := r.roomRepo.UpdateGroupMembers(roomId, &key, nil, userIds)
+	if errors.Is(err, repository.ErrDuplicatedKey) {
+		// Another group already has the same members, so this group could not be deduplicated anymore
+		err = r.roomRepo.UpdateGroupMembers(roomId, nil, nil, userIds)
+	}
+	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+// openPrivateRoom Used to get the room with the same direct key or create it with the users as members
+func (r roomService) openPrivateRoom(room *model.Room, role model.RoomRole, userIds ...string) (dto.CreateRoomOutput, bool, common.Error) {
+	existing, err := r.roomRepo.FindRoomByDirectKey(*room.DirectKey)
+	if err != nil {
+		return dto.CreateRoomOutput{}, false, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if !strutil.IsEmpty(existing.Id) {
+		return dto.NewCreateRoomOutput(existing), false, common.NoError()
+	}
+
+	userRooms := containers.ConvertSlice(userIds, func(current *string) model.UserRoom {
+		return model.NewUserRoom(room.Id, *current, role)
+	})
+	err = r.roomRepo.CreateRoomWithMembers(room, userRooms)
+	if err == nil {
+		return dto.NewCreateRoomOutput(room), true, common.NoError()
+	}
+
+	// The unique direct key is violated when the room is created concurrently, so use the existing one
+	existing, err = r.roomRepo.FindRoomByDirectKey(*room.DirectKey)
+	if err != nil || strutil.IsEmpty(existing.Id) {
+		return dto.CreateRoomOutput{}, false, common.NewError(common.ROOM_CREATE_ERROR, constant.MSG_ROOM_CREATION_FAILED)
+	}
+	return dto.NewCreateRoomOutput(existing), false, common.NoError()
+}
+
+// groupMemberIds Used to get all member ids of the group room
+func (r roomService) groupMemberIds(roomId string) ([]string, common.Error) {
+	userRooms, err := r.userRoomRepo.FindUserRoomsByRoomId(roomId)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	return containers.ConvertSlice(userRooms, func(current *model.UserRoom) string {
+		return current.UserId
+	}), common.NoError()
+}
+
+func (r roomService) FindRooms(includeArchived bool) ([]dto.RoomResponse, common.Error) {
+	rooms, err := r.roomRepo.FindRooms(includeArchived)
 	roomResponses := containers.ConvertSlice(rooms, dto.NewRoomResponse)
 	return roomResponses, common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
 }
 
+func (r roomService) BrowseRooms(input *dto.BrowseRoomInput) (dto.BrowseRoomOutput, common.Error) {
+	input.Normalize()
+	rooms, total, err := r.roomRepo.FindPublicRooms(input.WorkspaceId, input.Query, input.Offset(), input.PageSize)
+	if err != nil {
+		return dto.BrowseRoomOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	responses := containers.ConvertSlice(rooms, dto.NewRoomDirectoryResponse)
+	for i := range responses {
+		responses[i].MemberCount, err = r.userRoomRepo.GetRoomMemberCountById(responses[i].Id)
+		if err != nil {
+			return dto.BrowseRoomOutput{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+		}
+	}
+
+	output := dto.BrowseRoomOutput{
+		Rooms:    responses,
+		Total:    total,
+		Page:     input.Page,
+		PageSize: input.PageSize,
+	}
+	return output, common.NoError()
+}
+
 func (r roomService) FindRoomById(roomId string) (*dto.RoomResponse, common.Error) {
 	room, err := r.roomRepo.FindRoomById(roomId)
 	roomResponse := dto.NewRoomResponse(room)
 	return &roomResponse, common.NewConditionalError(err, common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
 }
 
+func (r roomService) UpdateRoomById(roomId string, input *dto.UpdateRoomInput) (dto.RoomResponse, common.Error) {
+	if !input.Validate() {
+		return dto.RoomResponse{}, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_BAD_BODY_REQUEST)
+	}
+
+	room, err := r.roomRepo.FindRoomById(roomId)
+	if err != nil || strutil.IsEmpty(room.Id) {
+		return dto.RoomResponse{}, common.NewError(common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+	}
+
+	dto.UpdateRoomFromInput(room, input)
+	err = r.roomRepo.UpdateRoomById(roomId, room)
+	return dto.NewRoomResponse(room), common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_ROOM_UPDATE_FAILED)
+}
+
+func (r roomService) SetRoomArchivedById(roomId string, archived bool) (dto.RoomResponse, common.Error) {
+	err := r.roomRepo.UpdateRoomArchivedById(roomId, archived)
+	if err != nil {
+		return dto.RoomResponse{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_ROOM_UPDATE_FAILED)
+	}
+
+	room, err := r.roomRepo.FindRoomById(roomId)
+	return dto.NewRoomResponse(room), common.NewConditionalError(err, common.ROOM_NOT_FOUND_ERROR, constant.MSG_ROOM_NOT_FOUND)
+}
+
 func (r roomService) FindUserRoomsByUserId(userId string) ([]dto.UserRoomResponse, common.Error) {
 	userRooms, err := r.userRoomRepo.FindUserRoomsByUserId(userId)
 	if err != nil {
@@ -86,6 +277,29 @@ func (r roomService) FindUserRoomsByUserId(userId string) ([]dto.UserRoomRespons
 	return roomResponse, common.NoError()
 }
 
+func (r roomService) UpdateRoomPreference(userId string, input *dto.RoomPreferenceInput) (dto.RoomPreferenceResponse, common.Error) {
+	if !input.Validate() {
+		return dto.RoomPreferenceResponse{}, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_NOTIF_LEVEL_NOT_FOUND)
+	}
+
+	userRoom, err := r.userRoomRepo.FindUserRoom(input.RoomId, userId)
+	if err != nil {
+		return dto.RoomPreferenceResponse{}, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if userRoom.Id == 0 {
+		return dto.RoomPreferenceResponse{}, common.NewError(common.USER_NOT_ROOM_MEMBER, constant.MSG_USER_NOT_ROOM_MEMBER)
+	}
+
+	dto.UpdateUserRoomFromPreference(userRoom, input)
+	err = r.userRoomRepo.UpdateUserRoomPreference(userRoom)
+	return dto.NewRoomPreferenceResponse(userRoom), common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (r roomService) ReorderRooms(userId string, roomIds []string) common.Error {
+	err := r.userRoomRepo.UpdateUserRoomPositions(userId, roomIds)
+	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
 func (r roomService) FindRoomsByUserId(userId string) ([]dto.RoomResponse, common.Error) {
 	rooms, err := r.roomRepo.FindRoomsByUserId(userId)
 	if err != nil {
@@ -128,6 +342,74 @@ func (r roomService) FindRoomMembersById(roomId string) ([]dto.UserResponse, com
 	return userResponse, common.NoError()
 }
 
+func (r roomService) FindPushReceiverIds(message *model.Message) ([]string, common.Error) {
+	userRooms, err := r.userRoomRepo.FindUserRoomsByRoomId(message.ReceiverId)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	users, err := r.userRoomRepo.FindUsersByRoomId(message.ReceiverId)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	// User's name is the unique username used to login, so the mention could not match another member
+	usernames := make(map[string]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Name
+	}
+
+	now := time.Now()
+	receiverIds := make([]string, 0, len(userRooms))
+	for _, userRoom := range userRooms {
+		if userRoom.UserId == message.SenderId {
+			continue
+		}
+		if userRoom.ShouldNotify(message.Mentions(usernames[userRoom.UserId]), now) {
+			receiverIds = append(receiverIds, userRoom.UserId)
+		}
+	}
+	return receiverIds, common.NoError()
+}
+
+func (r roomService) FindRoomMemberCountById(roomId string) (int64, common.Error) {
+	count, err := r.userRoomRepo.GetRoomMemberCountById(roomId)
+	return count, common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (r roomService) TransferRoomOwnership(roomId string, userId string) common.Error {
+	err := r.roomRepo.UpdateRoomOwner(roomId, userId)
+	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (r roomService) FindRoomMemberRolesById(roomId string) ([]dto.UserWithRole, common.Error) {
+	userRooms, err := r.userRoomRepo.FindUserRoomsByRoomId(roomId)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	return containers.ConvertSlice(userRooms, func(current *model.UserRoom) dto.UserWithRole {
+		return dto.NewUserRole(current.UserId, current.UserRole)
+	}), common.NoError()
+}
+
+func (r roomService) PromoteOldestMember(roomId string) (string, common.Error) {
+	userRooms, err := r.userRoomRepo.FindUserRoomsByRoomId(roomId)
+	if err != nil {
+		return "", common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	hasAdmin := containers.IsExist(userRooms, func(current *model.UserRoom) bool {
+		return current.UserRole == model.RoomRoleAdmin
+	})
+	if hasAdmin || containers.IsEmpty(userRooms) {
+		return "", common.NoError()
+	}
+
+	// User rooms are already ordered by the joined time
+	oldest := userRooms[0]
+	err = r.userRoomRepo.UpdateUserRoleById(roomId, oldest.UserId, model.RoomRoleAdmin)
+	return oldest.UserId, common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
 func (r roomService) AddUsersInRoom(input dto.UserRoomAddInput, allowPrivate bool) common.Error {
 	// Check room existence
 	room, err := r.roomRepo.FindRoomById(input.RoomId)
@@ -148,6 +430,10 @@ func (r roomService) AddUsersInRoom(input dto.UserRoomAddInput, allowPrivate boo
 
 func (r roomService) RemoveUsersInRoom(input dto.UserRoomRemoveInput) common.Error {
 	err := r.userRoomRepo.RemoveUsersFromRoomById(input.RoomId, input.UserIds)
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
 	// Remove room when there are no members
 	count, err := r.userRoomRepo.GetRoomMemberCountById(input.RoomId)
 	if err != nil {
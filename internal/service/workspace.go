@@ -0,0 +1,165 @@
+package service
+
+import (
+	"chatto/internal/constant"
+	"chatto/internal/dto"
+	"chatto/internal/model"
+	"chatto/internal/model/common"
+	"chatto/internal/repository"
+	"chatto/internal/util/containers"
+)
+
+type IWorkspaceService interface {
+	// CreateWorkspace Used to create workspace with the owner as workspace's admin
+	CreateWorkspace(ownerId string, input *dto.CreateWorkspaceInput) (dto.WorkspaceResponse, common.Error)
+	FindWorkspaces() ([]dto.WorkspaceResponse, common.Error)
+	FindWorkspaceById(workspaceId string) (*dto.WorkspaceResponse, common.Error)
+	// FindWorkspacesByUserId Used to get all workspaces of the user with the user's role
+	FindWorkspacesByUserId(userId string) ([]dto.UserWorkspaceResponse, common.Error)
+	FindWorkspaceMembers(workspaceId string) ([]dto.WorkspaceMemberResponse, common.Error)
+	// FindMemberRole Used to get user's role on the workspace, it will return error when the user is not workspace's member
+	FindMemberRole(workspaceId string, userId string) (model.WorkspaceRole, common.Error)
+	// UpdateWorkspaceById Used to update workspace's information based on non-nil fields of the input
+	UpdateWorkspaceById(workspaceId string, input *dto.UpdateWorkspaceInput) (dto.WorkspaceResponse, common.Error)
+	// AddWorkspaceMembers Used to add users into the workspace and join them into its default rooms, the existing members will have the role.
+	// It returns the default room ids
+	AddWorkspaceMembers(workspaceId string, userIds []string, role model.WorkspaceRole) ([]string, common.Error)
+	// RemoveWorkspaceMember Used to remove user from the workspace and all of its rooms, it returns the room ids the user left
+	RemoveWorkspaceMember(workspaceId string, userId string) ([]string, common.Error)
+	// DeleteWorkspaceById Used to delete workspace, the workspace should have no rooms left
+	DeleteWorkspaceById(workspaceId string) common.Error
+}
+
+func NewWorkspaceService(workspaceRepository repository.IWorkspaceRepository, roomRepository repository.IRoomRepository) IWorkspaceService {
+	return workspaceService{workspaceRepo: workspaceRepository, roomRepo: roomRepository}
+}
+
+type workspaceService struct {
+	workspaceRepo repository.IWorkspaceRepository
+	roomRepo      repository.IRoomRepository
+}
+
+func (w workspaceService) CreateWorkspace(ownerId string, input *dto.CreateWorkspaceInput) (dto.WorkspaceResponse, common.Error) {
+	workspace := dto.NewWorkspaceFromCreateInput(input, ownerId)
+	owner := model.NewWorkspaceMember(workspace.Id, ownerId, model.WorkspaceRoleAdmin)
+
+	err := w.workspaceRepo.CreateWorkspace(workspace, owner)
+	return dto.NewWorkspaceResponse(workspace), common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_WORKSPACE_CREATION_FAILED)
+}
+
+func (w workspaceService) FindWorkspaces() ([]dto.WorkspaceResponse, common.Error) {
+	workspaces, err := w.workspaceRepo.FindWorkspaces()
+	responses := containers.ConvertSlice(workspaces, dto.NewWorkspaceResponse)
+	return responses, common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (w workspaceService) FindWorkspaceById(workspaceId string) (*dto.WorkspaceResponse, common.Error) {
+	workspace, err := w.workspaceRepo.FindWorkspaceById(workspaceId)
+	if err != nil {
+		return nil, common.NewError(common.WORKSPACE_NOT_FOUND_ERROR, constant.MSG_WORKSPACE_NOT_FOUND)
+	}
+	response := dto.NewWorkspaceResponse(workspace)
+	return &response, common.NoError()
+}
+
+func (w workspaceService) FindWorkspacesByUserId(userId string) ([]dto.UserWorkspaceResponse, common.Error) {
+	workspaces, err := w.workspaceRepo.FindWorkspacesByUserId(userId)
+	responses := containers.ConvertSlice(workspaces, dto.NewUserWorkspaceResponse)
+	return responses, common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (w workspaceService) FindWorkspaceMembers(workspaceId string) ([]dto.WorkspaceMemberResponse, common.Error) {
+	members, err := w.workspaceRepo.FindWorkspaceMembers(workspaceId)
+	responses := containers.ConvertSlice(members, dto.NewWorkspaceMemberResponse)
+	return responses, common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
+
+func (w workspaceService) FindMemberRole(workspaceId string, userId string) (model.WorkspaceRole, common.Error) {
+	member, err := w.workspaceRepo.FindWorkspaceMember(workspaceId, userId)
+	if err != nil {
+		return "", common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if member.Id == 0 {
+		return "", common.NewError(common.WORKSPACE_NOT_MEMBER_ERROR, constant.MSG_NOT_WORKSPACE_MEMBER)
+	}
+	return member.Role, common.NoError()
+}
+
+func (w workspaceService) UpdateWorkspaceById(workspaceId string, input *dto.UpdateWorkspaceInput) (dto.WorkspaceResponse, common.Error) {
+	if !input.Validate() {
+		return dto.WorkspaceResponse{}, common.NewError(common.BAD_BODY_REQUEST_ERROR, constant.MSG_BAD_BODY_REQUEST)
+	}
+
+	workspace, err := w.workspaceRepo.FindWorkspaceById(workspaceId)
+	if err != nil {
+		return dto.WorkspaceResponse{}, common.NewError(common.WORKSPACE_NOT_FOUND_ERROR, constant.MSG_WORKSPACE_NOT_FOUND)
+	}
+
+	dto.UpdateWorkspaceFromInput(workspace, input)
+	err = w.workspaceRepo.UpdateWorkspaceById(workspaceId, workspace)
+	return dto.NewWorkspaceResponse(workspace), common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_WORKSPACE_UPDATE_FAILED)
+}
+
+func (w workspaceService) AddWorkspaceMembers(workspaceId string, userIds []string, role model.WorkspaceRole) ([]string, common.Error) {
+	_, err := w.workspaceRepo.FindWorkspaceById(workspaceId)
+	if err != nil {
+		return nil, common.NewError(common.WORKSPACE_NOT_FOUND_ERROR, constant.MSG_WORKSPACE_NOT_FOUND)
+	}
+
+	rooms, err := w.roomRepo.FindRoomsByWorkspaceId(workspaceId, true)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	members := make([]model.WorkspaceMember, 0, len(userIds))
+	userRooms := make([]model.UserRoom, 0, len(userIds)*len(rooms))
+	for _, userId := range userIds {
+		members = append(members, model.NewWorkspaceMember(workspaceId, userId, role))
+		for _, room := range rooms {
+			userRooms = append(userRooms, model.NewUserRoom(room.Id, userId, model.RoomRoleUser))
+		}
+	}
+
+	err = w.workspaceRepo.AddWorkspaceMembers(members, userRooms)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	roomIds := containers.ConvertSlice(rooms, func(current *model.Room) string {
+		return current.Id
+	})
+	return roomIds, common.NoError()
+}
+
+func (w workspaceService) RemoveWorkspaceMember(workspaceId string, userId string) ([]string, common.Error) {
+	rooms, err := w.roomRepo.FindRoomsByUserId(userId)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	err = w.workspaceRepo.RemoveWorkspaceMember(workspaceId, userId)
+	if err != nil {
+		return nil, common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+
+	roomIds := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		if room.WorkspaceId != nil && *room.WorkspaceId == workspaceId {
+			roomIds = append(roomIds, room.Id)
+		}
+	}
+	return roomIds, common.NoError()
+}
+
+func (w workspaceService) DeleteWorkspaceById(workspaceId string) common.Error {
+	rooms, err := w.roomRepo.FindRoomsByWorkspaceId(workspaceId, false)
+	if err != nil {
+		return common.NewError(common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+	}
+	if !containers.IsEmpty(rooms) {
+		return common.NewError(common.WORKSPACE_NOT_EMPTY_ERROR, constant.MSG_REMOVE_NON_EMPTY_WORKSPACE)
+	}
+
+	err = w.workspaceRepo.DeleteWorkspaceById(workspaceId)
+	return common.NewConditionalError(err, common.INTERNAL_SERVER_ERROR, constant.MSG_INTERNAL_SERVER_ERROR)
+}
@@ -32,6 +32,13 @@ func SliceFilter[T comparable](data []T, filterFunc func(current *T) bool) []T {
 	return result
 }
 
+// SliceReverse Used to reverse the slice order in place
+func SliceReverse[T any](data []T) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
+
 type EqualFunc[T any] func(current T) bool
 type EqualFuncMap[K comparable, V any] func(key K, val V) bool
 
@@ -0,0 +1,273 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"chatto/internal/constant"
+	"chatto/internal/model"
+	"chatto/internal/util"
+	"chatto/internal/ws/manager"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func NewBus(nodeId string, client *redis.Client, roomManager *manager.RoomManager, clientManager *manager.ClientManager) *Bus {
+	return &Bus{
+		nodeId:        nodeId,
+		client:        client,
+		roomManager:   roomManager,
+		clientManager: clientManager,
+		outgoing:      make(chan outgoingEvent, constant.CLUSTER_PUBLISH_BUFFER_SIZE),
+		seen:          newDedup(constant.CLUSTER_DEDUP_SIZE),
+		membership:    make(chan struct{}, 1),
+		pendingRooms:  make(map[string]struct{}),
+	}
+}
+
+type outgoingEvent struct {
+	channel string
+	event   *Event
+}
+
+// Bus Used to deliver room broadcasts, user payloads and presence into the clients connected on the other nodes using Redis pub/sub
+type Bus struct {
+	nodeId string
+	client *redis.Client
+
+	roomManager   *manager.RoomManager
+	clientManager *manager.ClientManager
+
+	// membershipHandler Used to reload the rooms changed on the other nodes
+	membershipHandler func(roomIds []string)
+	membership        chan struct{} // Used to wake up the membership worker, the changed rooms are kept on pendingRooms
+	pendingMutex      sync.Mutex
+	pendingRooms      map[string]struct{}
+
+	pubsub        *redis.PubSub
+	outgoingMutex sync.RWMutex
+	outgoing      chan outgoingEvent
+	stopped       bool
+	seen          *dedup
+	wg            sync.WaitGroup
+}
+
+func (b *Bus) NodeId() string {
+	return b.nodeId
+}
+
+// SetMembershipHandler Used to handle the membership events, it should be set before Start
+func (b *Bus) SetMembershipHandler(handler func(roomIds []string)) {
+	b.membershipHandler = handler
+}
+
+// Start Used to subscribe the cluster channels and publish the events in order, it returns when the subscription is ready
+func (b *Bus) Start() error {
+	b.pubsub = b.client.Subscribe(context.Background(), constant.REDIS_CHANNEL_ROOM, constant.REDIS_CHANNEL_USER, constant.REDIS_CHANNEL_PRESENCE, constant.REDIS_CHANNEL_MEMBERSHIP)
+	ctx, cancel := util.NewTimeoutContext()
+	defer cancel()
+	// Wait for the subscription confirmation, so no event is missed after Start
+	for subscribed := 0; subscribed < 4; {
+		msg, err := b.pubsub.Receive(ctx)
+		if err != nil {
+			return err
+		}
+		if _, ok := msg.(*redis.Subscription); ok {
+			subscribed++
+		}
+	}
+
+	b.wg.Add(3)
+	go b.publishHandle()
+	go b.membershipHandle()
+	go b.receiveHandle(b.pubsub.Channel())
+	return nil
+}
+
+// Stop Used to publish the queued events and unsubscribe the channels, events published after it are ignored
+func (b *Bus) Stop() {
+	b.outgoingMutex.Lock()
+	b.stopped = true
+	close(b.outgoing)
+	b.outgoingMutex.Unlock()
+
+	if err := b.pubsub.Close(); err != nil {
+		log.Println(err)
+	}
+	b.wg.Wait()
+}
+
+// PublishRoom Used as model.RoomPublisher
+func (b *Bus) PublishRoom(broadcast *model.RoomBroadcast) {
+	payload, err := NewPayload(broadcast.Payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	b.publish(constant.REDIS_CHANNEL_ROOM, &Event{
+		RoomId:           broadcast.RoomId,
+		ExcludeClientIds: broadcast.ExcludeClientIds,
+		ExcludeUserId:    broadcast.ExcludeUserId,
+		Seqs:             broadcast.Seqs,
+		Payload:          payload,
+	})
+}
+
+func (b *Bus) PublishUsers(payload *model.PayloadOutput, userIds []string, seqs map[string]uint64) {
+	clusterPayload, err := NewPayload(payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	b.publish(constant.REDIS_CHANNEL_USER, &Event{
+		UserIds: userIds,
+		Seqs:    seqs,
+		Payload: clusterPayload,
+	})
+}
+
+func (b *Bus) PublishPresence(userId string, ownPayload *model.PayloadOutput, publicPayload *model.PayloadOutput) {
+	own, err := NewPayload(ownPayload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	public, err := NewPayload(publicPayload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	b.publish(constant.REDIS_CHANNEL_PRESENCE, &Event{
+		UserIds:       []string{userId},
+		Payload:       own,
+		PublicPayload: public,
+	})
+}
+
+// PublishMembership Used as manager.MembershipPublisher
+func (b *Bus) PublishMembership(roomIds []string) {
+	b.publish(constant.REDIS_CHANNEL_MEMBERSHIP, &Event{
+		RoomIds: roomIds,
+	})
+}
+
+func (b *Bus) publish(channel string, event *Event) {
+	event.Id = uuid.NewString()
+	event.NodeId = b.nodeId
+
+	b.outgoingMutex.RLock()
+	defer b.outgoingMutex.RUnlock()
+	if b.stopped {
+		return
+	}
+	b.outgoing <- outgoingEvent{channel: channel, event: event}
+}
+
+// publishHandle Used to publish the events by single goroutine, so the events order is kept
+func (b *Bus) publishHandle() {
+	defer b.wg.Done()
+	for outgoing := range b.outgoing {
+		bytes, err := json.Marshal(outgoing.event)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		ctx, cancel := util.NewTimeoutContext()
+		if err = b.client.Publish(ctx, outgoing.channel, bytes).Err(); err != nil {
+			log.Println("Cluster Publish Error: ", err)
+		}
+		cancel()
+	}
+}
+
+// membershipHandle Used to reload the changed rooms outside the receive loop, so the other events don't wait for the database
+func (b *Bus) membershipHandle() {
+	defer b.wg.Done()
+	for range b.membership {
+		b.handleMembership()
+	}
+}
+
+// handleMembership Used to reload all the pending rooms at once, the room changed several times is only reloaded once
+func (b *Bus) handleMembership() {
+	b.pendingMutex.Lock()
+	roomIds := make([]string, 0, len(b.pendingRooms))
+	for roomId := range b.pendingRooms {
+		roomIds = append(roomIds, roomId)
+	}
+	b.pendingRooms = make(map[string]struct{})
+	b.pendingMutex.Unlock()
+
+	if b.membershipHandler != nil && len(roomIds) != 0 {
+		b.membershipHandler(roomIds)
+	}
+}
+
+func (b *Bus) receiveHandle(messages <-chan *redis.Message) {
+	defer b.wg.Done()
+	// The receive loop is the only one waking up the membership worker
+	defer close(b.membership)
+	for msg := range messages {
+		var event Event
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Println("Cluster Event Error: ", err)
+			continue
+		}
+		b.handle(msg.Channel, &event)
+	}
+}
+
+// handle Used to deliver the event into local clients, the events from this node and the duplicated events are ignored
+func (b *Bus) handle(channel string, event *Event) {
+	if event.NodeId == b.nodeId || b.seen.Seen(event.Id) {
+		return
+	}
+
+	// Membership event has no payload, the rooms are reloaded by the membership worker
+	if channel == constant.REDIS_CHANNEL_MEMBERSHIP {
+		if len(event.RoomIds) == 0 {
+			return
+		}
+		b.pendingMutex.Lock()
+		for _, roomId := range event.RoomIds {
+			b.pendingRooms[roomId] = struct{}{}
+		}
+		b.pendingMutex.Unlock()
+		select {
+		case b.membership <- struct{}{}:
+		default:
+			// The worker is already woken up
+		}
+		return
+	}
+	if event.Payload == nil {
+		return
+	}
+
+	switch channel {
+	case constant.REDIS_CHANNEL_ROOM:
+		room, err := b.roomManager.GetRoomById(event.RoomId)
+		if err != nil {
+			// No client of the room on this node
+			return
+		}
+		room.BroadcastLocal(&model.RoomBroadcast{
+			RoomId:           event.RoomId,
+			Payload:          event.Payload.PayloadOutput(),
+			ExcludeClientIds: event.ExcludeClientIds,
+			ExcludeUserId:    event.ExcludeUserId,
+			Seqs:             event.Seqs,
+		})
+	case constant.REDIS_CHANNEL_USER:
+		b.clientManager.SendToUsersLocal(event.Payload.PayloadOutput(), event.UserIds, event.Seqs)
+	case constant.REDIS_CHANNEL_PRESENCE:
+		if len(event.UserIds) == 0 || event.PublicPayload == nil {
+			return
+		}
+		b.clientManager.SendPresenceLocal(event.UserIds[0], event.Payload.PayloadOutput(), event.PublicPayload.PayloadOutput())
+	}
+}
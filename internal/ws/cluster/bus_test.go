@@ -0,0 +1,230 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"chatto/internal/model"
+	"chatto/internal/ws/manager"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type testNode struct {
+	bus           *Bus
+	roomManager   *manager.RoomManager
+	clientManager *manager.ClientManager
+	room          *model.ChatRoom
+}
+
+func newTestNode(nodeId string, client *redis.Client) *testNode {
+	roomManager := manager.NewRoomManager()
+	clientManager := manager.NewClientManager()
+	node := &testNode{
+		roomManager:   &roomManager,
+		clientManager: &clientManager,
+		room:          model.NewChatRoom("room", "room", "", false),
+	}
+	node.bus = NewBus(nodeId, client, node.roomManager, node.clientManager)
+	node.roomManager.AddRooms(node.room)
+	return node
+}
+
+func (n *testNode) connect(userId string) *model.Client {
+	client := model.NewClient(userId, userId, model.UserRole, nil, 10, model.OutboundDropOldest)
+	n.clientManager.AddClients(client)
+	n.room.AddClient(client, model.RoomRoleUser)
+	return client
+}
+
+func newTestPayload(message string) *model.PayloadOutput {
+	payload := model.NewPayloadOutput(model.PayloadMessage, &message)
+	return &payload
+}
+
+// expectPayload Used to check the client receives the payload with the message, empty message means no payload is expected
+func expectPayload(t *testing.T, client *model.Client, message string) {
+	t.Helper()
+	if len(message) == 0 {
+		select {
+		case payload := <-client.IncomingPayload:
+			t.Fatalf("client %s received unexpected payload %v", client.UserId, payload)
+		case <-time.After(200 * time.Millisecond):
+		}
+		return
+	}
+
+	select {
+	case payload := <-client.IncomingPayload:
+		bytes, err := json.Marshal(payload.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if err = json.Unmarshal(bytes, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != message {
+			t.Fatalf("client %s received %v, want %v", client.UserId, got, message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("client %s didn't receive %v", client.UserId, message)
+	}
+}
+
+func TestDedup_Seen(t *testing.T) {
+	d := newDedup(2)
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "1", want: false},
+		{id: "1", want: true},
+		{id: "2", want: false},
+		{id: "3", want: false}, // "1" is forgotten
+		{id: "2", want: true},
+		{id: "1", want: false},
+	}
+	for _, tt := range tests {
+		if got := d.Seen(tt.id); got != tt.want {
+			t.Errorf("Seen(%v) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestBus_handle(t *testing.T) {
+	node := newTestNode("node", nil)
+	client := node.connect("user")
+	payload, err := NewPayload(newTestPayload("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Event from this node is already delivered locally
+	node.bus.handle("cluster:room", &Event{Id: "1", NodeId: "node", RoomId: "room", Payload: payload})
+	expectPayload(t, client, "")
+
+	node.bus.handle("cluster:room", &Event{Id: "2", NodeId: "other", RoomId: "room", Payload: payload})
+	expectPayload(t, client, "hello")
+
+	// Duplicated event
+	node.bus.handle("cluster:room", &Event{Id: "2", NodeId: "other", RoomId: "room", Payload: payload})
+	expectPayload(t, client, "")
+
+	node.bus.handle("cluster:room", &Event{Id: "3", NodeId: "other", RoomId: "room", ExcludeUserId: "user", Payload: payload})
+	expectPayload(t, client, "")
+
+	node.bus.handle("cluster:user", &Event{Id: "4", NodeId: "other", UserIds: []string{"user"}, Payload: payload})
+	expectPayload(t, client, "hello")
+
+	var synced []string
+	node.bus.SetMembershipHandler(func(roomIds []string) {
+		synced = append(synced, roomIds...)
+	})
+	node.bus.handle("cluster:membership", &Event{Id: "5", NodeId: "node", RoomIds: []string{"room"}})
+	node.bus.handle("cluster:membership", &Event{Id: "6", NodeId: "other", RoomIds: []string{"room"}})
+	node.bus.handle("cluster:membership", &Event{Id: "6", NodeId: "other", RoomIds: []string{"room"}})
+	if len(synced) != 0 {
+		t.Errorf("membership handled on the receive loop, rooms = %v", synced)
+	}
+	node.bus.handleMembership()
+	if len(synced) != 1 || synced[0] != "room" {
+		t.Errorf("membership handled rooms = %v, want [room]", synced)
+	}
+}
+
+// TestBus_Cluster Run two nodes sharing the Redis on CHATTO_TEST_REDIS_ADDR, the in-memory Redis is used when it is not set
+func TestBus_Cluster(t *testing.T) {
+	addr := os.Getenv("CHATTO_TEST_REDIS_ADDR")
+	if len(addr) == 0 {
+		addr = miniredis.RunT(t).Addr()
+	}
+	redisClient := redis.NewClient(&redis.Options{Addr: addr})
+	defer redisClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		t.Fatal("Redis is not available: ", err)
+	}
+
+	nodeA := newTestNode("node-a", redisClient)
+	nodeB := newTestNode("node-b", redisClient)
+	synced := make(chan []string, 1)
+	// Slow database should not hold back the other events
+	nodeB.bus.SetMembershipHandler(func(roomIds []string) {
+		time.Sleep(time.Second)
+		synced <- roomIds
+	})
+	for _, node := range []*testNode{nodeA, nodeB} {
+		if err := node.bus.Start(); err != nil {
+			t.Fatal(err)
+		}
+		node.roomManager.SetPublisher(node.bus.PublishRoom)
+		node.clientManager.SetPublisher(node.bus)
+	}
+	defer nodeA.bus.Stop()
+	defer nodeB.bus.Stop()
+
+	alice := nodeA.connect("alice")
+	bob := nodeB.connect("bob")
+	aliceOnB := nodeB.connect("alice")
+
+	t.Run("room broadcast", func(t *testing.T) {
+		nodeA.room.Broadcast(newTestPayload("hello"))
+		expectPayload(t, alice, "hello")
+		expectPayload(t, bob, "hello")
+		expectPayload(t, aliceOnB, "hello")
+		// Delivered exactly once
+		expectPayload(t, alice, "")
+		expectPayload(t, bob, "")
+	})
+
+	t.Run("typing excludes typist on every node", func(t *testing.T) {
+		nodeA.room.BroadcastExceptUser(newTestPayload("typing"), "alice")
+		expectPayload(t, bob, "typing")
+		expectPayload(t, alice, "")
+		expectPayload(t, aliceOnB, "")
+	})
+
+	t.Run("send to users", func(t *testing.T) {
+		nodeB.clientManager.SendToUsers(newTestPayload("prefs"), "alice")
+		expectPayload(t, aliceOnB, "prefs")
+		expectPayload(t, alice, "prefs")
+		expectPayload(t, bob, "")
+	})
+
+	t.Run("presence to subscribers", func(t *testing.T) {
+		bob.SubscribePresence(10, "alice")
+		nodeA.clientManager.SendPresence("alice", newTestPayload("own"), newTestPayload("public"))
+		expectPayload(t, alice, "own")
+		expectPayload(t, aliceOnB, "own")
+		expectPayload(t, bob, "public")
+	})
+
+	t.Run("membership off the receive loop", func(t *testing.T) {
+		nodeA.bus.PublishMembership([]string{"room"})
+		nodeA.room.Broadcast(newTestPayload("after membership"))
+		// Delivered while the membership is still being synced
+		expectPayload(t, bob, "after membership")
+		select {
+		case <-synced:
+			t.Fatal("event is delivered only after the membership is synced")
+		default:
+		}
+		expectPayload(t, alice, "after membership")
+		expectPayload(t, aliceOnB, "after membership")
+
+		select {
+		case roomIds := <-synced:
+			if len(roomIds) != 1 || roomIds[0] != "room" {
+				t.Errorf("membership handled rooms = %v, want [room]", roomIds)
+			}
+		case <-time.After(3 * time.Second):
+			t.Error("membership is not handled")
+		}
+	})
+}
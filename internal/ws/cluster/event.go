@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"encoding/json"
+	"sync"
+
+	"chatto/internal/model"
+)
+
+// Event Used to deliver payload between nodes, the sender node is excluded from the delivery because it already delivered it locally
+type Event struct {
+	Id     string `json:"id"`
+	NodeId string `json:"node_id"`
+
+	// Room event
+	RoomId           string   `json:"room_id,omitempty"`
+	ExcludeClientIds []string `json:"exclude_client_ids,omitempty"`
+	ExcludeUserId    string   `json:"exclude_user_id,omitempty"`
+
+	// Event sequence of each user for room and user event, key : userId
+	Seqs map[string]uint64 `json:"seqs,omitempty"`
+
+	// User and presence event
+	UserIds []string `json:"user_ids,omitempty"`
+
+	// Membership event
+	RoomIds []string `json:"room_ids,omitempty"`
+
+	Payload       *Payload `json:"payload"`
+	PublicPayload *Payload `json:"public_payload,omitempty"` // Presence as seen by the other users
+}
+
+// Payload Used to carry model.PayloadOutput with its coalesce key and feature, the data is kept as raw JSON
+type Payload struct {
+	Type        string          `json:"type"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	CoalesceKey string          `json:"coalesce_key,omitempty"`
+	Feature     string          `json:"feature,omitempty"`
+}
+
+func NewPayload(payload *model.PayloadOutput) (*Payload, error) {
+	data, err := json.Marshal(payload.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{
+		Type:        payload.Type,
+		Data:        data,
+		CoalesceKey: payload.CoalesceKey,
+		Feature:     payload.Feature,
+	}, nil
+}
+
+func (p *Payload) PayloadOutput() *model.PayloadOutput {
+	output := &model.PayloadOutput{
+		Type:        p.Type,
+		CoalesceKey: p.CoalesceKey,
+		Feature:     p.Feature,
+	}
+	// Keep omitted data as nil
+	if len(p.Data) != 0 && string(p.Data) != "null" {
+		output.Data = p.Data
+	}
+	return output
+}
+
+func newDedup(size int) *dedup {
+	return &dedup{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+// dedup Used to remember the latest event ids, the oldest id is forgotten when it is full
+type dedup struct {
+	mutex sync.Mutex
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+// Seen Used to check if the id is already seen, the id will be remembered
+func (d *dedup) Seen(id string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exist := d.ids[id]; exist {
+		return true
+	}
+
+	if oldest := d.order[d.next]; len(oldest) != 0 {
+		delete(d.ids, oldest)
+	}
+	d.order[d.next] = id
+	d.next = (d.next + 1) % len(d.order)
+	d.ids[id] = struct{}{}
+	return false
+}
@@ -3,8 +3,11 @@ package controller
 import (
 	"log"
 	"net/http"
+	"time"
 
+	"chatto/internal/config"
 	"chatto/internal/constant"
+	"chatto/internal/dto"
 	"chatto/internal/model"
 	"chatto/internal/model/common"
 	"chatto/internal/rest/controller"
@@ -16,20 +19,25 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-func NewWebsocketHandler(client chan<- *model.Client) controller.IController {
+func NewWebsocketHandler(config *config.AppConfig, client chan<- *model.Client, stop <-chan struct{}) controller.IController {
 	return &WebsocketHandler{
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
+			Subprotocols:    model.Subprotocols,
 		},
+		config: config,
 		client: client,
+		stop:   stop,
 	}
 }
 
 type WebsocketHandler struct {
 	upgrader websocket.Upgrader
+	config   *config.AppConfig
 
 	client chan<- *model.Client
+	stop   <-chan struct{}
 }
 
 func (w *WebsocketHandler) Route(router gin.IRouter, middleware *middleware.Middleware) {
@@ -45,13 +53,28 @@ func (w *WebsocketHandler) ServeWebsocket(ctx *gin.Context) {
 		conn, err := w.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 		if err != nil {
 			log.Println(err)
+			return
 		}
 
-		client := model.NewClient(claims.UserId, claims.Name, claims.Role, conn)
-		w.registerClient(&client)
+		client := model.NewClient(claims.UserId, claims.Name, claims.Role, conn, w.config.OutboundQueueSize, w.config.OutboundPolicy)
+		client.Codec = model.CodecBySubprotocol(conn.Subprotocol())
+		// Malformed session is ignored, so new session will be created
+		var session dto.SessionInput
+		if err = ctx.ShouldBindQuery(&session); err == nil {
+			client.ResumeSessionId = session.SessionId
+			client.ResumeSeq = session.Seq
+		}
+		w.registerClient(client)
 	}
 }
 
+// registerClient Used to pass the client into the client handler, the connection is closed when the server is shutting down
 func (w *WebsocketHandler) registerClient(client *model.Client) {
-	w.client <- client
+	select {
+	case w.client <- client:
+	case <-w.stop:
+		message := websocket.FormatCloseMessage(websocket.CloseGoingAway, constant.CLOSE_REASON_SHUTDOWN)
+		_ = client.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		_ = client.Conn.Close()
+	}
 }
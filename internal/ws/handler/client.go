@@ -1,80 +1,323 @@
 package handler
 
 import (
+	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"chatto/internal/config"
+	"chatto/internal/constant"
+	"chatto/internal/dto"
 	"chatto/internal/model"
+	"chatto/internal/model/common"
 	"chatto/internal/service"
+	"chatto/internal/util"
+	"chatto/internal/ws/manager"
 
 	"github.com/gorilla/websocket"
 )
 
-func StartClientHandler(chatService service.IChatService, client <-chan *model.Client, payload chan<- *model.Payload) {
+func StartClientHandler(config *config.AppConfig, chatService service.IChatService, client <-chan *model.Client, payload chan<- *model.Payload, stop <-chan struct{}) *ClientHandler {
 	handler := &ClientHandler{
-		chatService: chatService,
-		payload:     payload,
-		client:      client,
+		chatService:  chatService,
+		payload:      payload,
+		client:       client,
+		stop:         stop,
+		pingInterval: time.Duration(config.PingInterval) * time.Second,
+		readTimeout:  time.Duration(config.ReadTimeout) * time.Second,
+		writeTimeout: time.Duration(config.WriteTimeout) * time.Second,
+	}
+	handler.limits = dto.ProtocolLimits{
+		MaxFrameSize:             constant.CLIENT_READ_LIMIT_SIZE,
+		MaxPageSize:              constant.MESSAGE_MAX_PAGE_SIZE,
+		MaxPresenceSubscriptions: constant.PRESENCE_MAX_SUBSCRIPTIONS,
+		OutboundQueueSize:        config.OutboundQueueSize,
+		PingInterval:             handler.pingInterval.Milliseconds(),
+		ReadTimeout:              handler.readTimeout.Milliseconds(),
 	}
 
 	go handler.ClientHandle()
+	return handler
 }
 
 type ClientHandler struct {
 	payload chan<- *model.Payload
 	client  <-chan *model.Client
+	stop    <-chan struct{}
+
+	// draining is set when the server is shutting down, the read handles stop without closing the connection
+	drainMutex sync.Mutex
+	draining   atomic.Bool
+	readers    sync.WaitGroup
+	writers    sync.WaitGroup
+
+	pingInterval time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	limits       dto.ProtocolLimits // Sent as the answer of the hello
 
 	chatService service.IChatService
 }
 
 func (c *ClientHandler) ClientHandle() {
-	for client := range c.client {
-		if c.registerClient(client) != nil {
-			c.unregisterClient(client)
-			continue
+	for {
+		select {
+		case client := <-c.client:
+			c.startClient(client)
+		case <-c.stop:
+			log.Println("Client Stopped")
+			return
 		}
-		go c.ClientReadHandle(client)
-		go c.ClientWriteHandle(client)
+	}
+}
+
+// StopReading Used to stop reading payloads from the clients and wait until all read handles are stopped, the connections are kept open
+// so the queued payloads could still be written
+func (c *ClientHandler) StopReading(clientManager *manager.ClientManager) {
+	c.drainMutex.Lock()
+	c.draining.Store(true)
+	c.drainMutex.Unlock()
+
+	// Clients registered after draining are closed by startClient
+	for _, client := range clientManager.Clients() {
+		_ = client.Conn.SetReadDeadline(time.Now())
+	}
+	c.readers.Wait()
+}
+
+// WaitWriters Used to wait until all write handles are stopped
+func (c *ClientHandler) WaitWriters() {
+	c.writers.Wait()
+}
+
+func (c *ClientHandler) startClient(client *model.Client) {
+	if c.registerClient(client) != nil {
+		c.unregisterClient(client)
+		return
+	}
+	// Started after registered, so the events after the replay are queued
+	initial := c.startSession(client)
+
+	c.drainMutex.Lock()
+	defer c.drainMutex.Unlock()
+	// Registered while the server is shutting down
+	if c.draining.Load() {
+		c.unregisterClient(client)
+		c.writeClose(client, websocket.CloseGoingAway, constant.CLOSE_REASON_SHUTDOWN)
+		_ = client.Conn.Close()
+		return
+	}
+
+	c.readers.Add(1)
+	c.writers.Add(1)
+	go c.ClientReadHandle(client)
+	go c.ClientWriteHandle(client, initial...)
+}
+
+// startSession Used to get the session payload and the replayed events, they are written before the queued payloads
+func (c *ClientHandler) startSession(client *model.Client) []*model.PayloadOutput {
+	session, events, cerr := c.chatService.StartSession(client)
+	if cerr.IsError() {
+		log.Println(cerr.Error())
+		return nil
 	}
 
-	log.Println("Client Stopped")
+	sessionOutput := model.NewPayloadOutput(model.PayloadSession, &session)
+	payloads := make([]*model.PayloadOutput, 0, len(events)+1)
+	payloads = append(payloads, &sessionOutput)
+	for i := range events {
+		payloads = append(payloads, &events[i])
+	}
+	return payloads
 }
 
-// ClientReadHandle Handle for reading each client message
+// ClientReadHandle Handle for reading each client message, the client is unregistered when the connection is closed or no pong message is received within read timeout
 func (c *ClientHandler) ClientReadHandle(client *model.Client) {
-	defer func() {
-		if err := client.Conn.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
+	defer c.readers.Done()
+
+	client.Conn.SetReadLimit(constant.CLIENT_READ_LIMIT_SIZE)
+	c.extendReadDeadline(client)
+	client.Conn.SetPongHandler(func(string) error {
+		c.extendReadDeadline(client)
+		return nil
+	})
 
+	first := true
 	for {
-		var input model.PayloadInput
-		err := client.Conn.ReadJSON(&input)
+		_, frame, err := client.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure, websocket.CloseGoingAway, 10054) {
-				c.unregisterClient(client)
-				break
+			// The write handle closes the connection after the outbound queue is written
+			if c.draining.Load() {
+				return
+			}
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure, websocket.CloseGoingAway, 10054) {
+				log.Println("Client ", client.Id, " Read Error: ", err)
+			}
+			c.unregisterClient(client)
+			if err = client.Conn.Close(); err != nil {
+				log.Println(err)
 			}
+			return
 		}
+		c.extendReadDeadline(client)
+
+		// Malformed payload doesn't break the connection
+		input, err := client.Codec.Decode(frame)
+		if err != nil {
+			log.Println("Client ", client.Id, " Decode Error: ", err)
+			continue
+		}
+		c.touchClient(client)
+
+		// Hello is only handled as the first payload, so the protocol is negotiated before the other payloads are dispatched
+		if first {
+			first = false
+			if input.Type == model.PayloadHello {
+				if c.handleHello(client, &input) != nil {
+					c.unregisterClient(client)
+					_ = client.Conn.Close()
+					return
+				}
+				continue
+			}
+		}
+
 		payload := c.chatService.ProcessPayload(client, &input)
 		c.payload <- &payload
+		if c.draining.Load() {
+			return
+		}
 	}
 }
 
-// ClientWriteHandle Handle for writing message to each client
-func (c *ClientHandler) ClientWriteHandle(client *model.Client) {
-	for msg := range client.IncomingPayload {
-		err := client.Conn.WriteJSON(msg)
-		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure, websocket.CloseGoingAway) {
-				break
+// ClientWriteHandle Handle for writing message and periodic ping message to each client, the initial payloads are written first, the connection is closed on write failure so the read handle will unregister the client.
+// When the outbound queue is closed, the coalesced payloads are written and the connection is closed with going away status
+func (c *ClientHandler) ClientWriteHandle(client *model.Client, initial ...*model.PayloadOutput) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer func() {
+		ticker.Stop()
+		// The connection could be closed already by the read handle
+		_ = client.Conn.Close()
+		c.writers.Done()
+	}()
+
+	for _, msg := range initial {
+		if c.write(client, msg) != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case msg, ok := <-client.IncomingPayload:
+			if !ok {
+				for _, msg := range client.TakeCoalesced() {
+					if c.writePayload(client, msg) != nil {
+						return
+					}
+				}
+				c.writeClose(client, websocket.CloseGoingAway, constant.CLOSE_REASON_SHUTDOWN)
+				return
+			}
+			if c.writePayload(client, msg) != nil {
+				return
+			}
+		case <-client.CoalescedReady:
+			for _, msg := range client.TakeCoalesced() {
+				if c.writePayload(client, msg) != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			_ = client.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
 			}
-			log.Println("Client ", *client, " Write Error: ", err)
-			continue
 		}
 	}
 }
 
+func (c *ClientHandler) writePayload(client *model.Client, payload *model.PayloadOutput) error {
+	// Already written by the replay
+	if !client.ShouldWrite(payload) {
+		return nil
+	}
+	return c.write(client, payload)
+}
+
+func (c *ClientHandler) write(client *model.Client, payload *model.PayloadOutput) error {
+	frame, err := client.Codec.Encode(payload)
+	if err != nil {
+		// Only the payload is skipped
+		log.Println("Client ", client.Id, " Encode Error: ", err)
+		return nil
+	}
+
+	_ = client.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	err = client.Conn.WriteMessage(client.Codec.MessageType(), frame)
+	if err != nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure, websocket.CloseGoingAway) {
+		log.Println("Client ", client.Id, " Write Error: ", err)
+	}
+	return err
+}
+
+// writeClose Used to write the close message with the status code
+func (c *ClientHandler) writeClose(client *model.Client, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := client.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(c.writeTimeout)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		log.Println("Client ", client.Id, " Close Error: ", err)
+	}
+}
+
+// handleHello Used to negotiate the client's protocol and answer it with the server's limits, it returns error when the client's protocol
+// version is not supported anymore and the connection should be closed
+func (c *ClientHandler) handleHello(client *model.Client, input *model.PayloadInput) error {
+	hello, err := model.PayloadData[dto.HelloInput](&model.Payload{Type: input.Type, Data: input.Data, Codec: client.Codec})
+	if err != nil {
+		// Malformed hello keeps the client as legacy
+		util.SendErrorPayload(client, common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD))
+		return nil
+	}
+
+	protocol, ok := model.NegotiateProtocol(hello.ProtocolVersion, hello.ClientName, hello.ClientVersion, hello.Features)
+	if !ok {
+		log.Println("Client ", client.Id, " Unsupported Protocol: ", hello.ProtocolVersion)
+		c.writeClose(client, websocket.CloseProtocolError, constant.CLOSE_REASON_UNSUPPORTED_PROTOCOL)
+		return common.NewError(common.PROTOCOL_UNSUPPORTED_ERROR, constant.MSG_UNSUPPORTED_PROTOCOL).Error()
+	}
+	client.SetProtocol(protocol)
+	log.Println("Client ", client.Id, " Protocol: ", protocol.Version, " ", protocol.ClientName, " ", protocol.ClientVersion)
+
+	response := dto.NewHelloResponse(protocol, c.limits)
+	output := model.NewPayloadOutput(model.PayloadHello, &response)
+	client.SendPayload(&output)
+	return nil
+}
+
+// extendReadDeadline Used to keep the connection alive until read timeout from now, the deadline is not extended when the handler is draining
+func (c *ClientHandler) extendReadDeadline(client *model.Client) {
+	deadline := time.Now().Add(c.readTimeout)
+	if c.draining.Load() {
+		deadline = time.Now()
+	}
+	if err := client.Conn.SetReadDeadline(deadline); err != nil {
+		log.Println(err)
+	}
+}
+
+// touchClient Used to update client's activity, idle user will be back online
+func (c *ClientHandler) touchClient(client *model.Client) {
+	client.Touch()
+	if !client.IsIdle() {
+		return
+	}
+	if cerr := c.chatService.ActivateClient(client); cerr.IsError() {
+		log.Println(cerr.Error())
+	}
+}
+
 func (c *ClientHandler) registerClient(client *model.Client) error {
 	log.Println("Registering client: ", client)
 	cerr := c.chatService.NewClient(client)
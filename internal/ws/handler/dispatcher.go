@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"chatto/internal/model"
+)
+
+// payloadShardData Fields of the payload data used as the shard key, the first non-empty field is used
+type payloadShardData struct {
+	RoomId     string `json:"room_id"`
+	ReceiverId string `json:"receiver_id"`
+}
+
+// PayloadShardKey Used to get the key deciding which worker handles the payload. Payloads of the same room share the key
+// so the order is kept, the other payloads use the sender's user id
+func PayloadShardKey(payload *model.Payload) string {
+	if data, err := model.PayloadData[payloadShardData](payload); err == nil {
+		if len(data.RoomId) != 0 {
+			return data.RoomId
+		}
+		if len(data.ReceiverId) != 0 {
+			return data.ReceiverId
+		}
+	}
+	if payload.Sender == nil {
+		return ""
+	}
+	return payload.Sender.UserId
+}
+
+func NewPayloadDispatcher(shardCount int, bufferSize int, handle func(payload *model.Payload)) *PayloadDispatcher {
+	if shardCount < 1 {
+		shardCount = 1
+	}
+
+	dispatcher := &PayloadDispatcher{
+		shards: make([]chan *model.Payload, shardCount),
+		handle: handle,
+	}
+	for i := range dispatcher.shards {
+		dispatcher.shards[i] = make(chan *model.Payload, bufferSize)
+		dispatcher.wg.Add(1)
+		go dispatcher.work(dispatcher.shards[i])
+	}
+	return dispatcher
+}
+
+// PayloadDispatcher Used to handle payloads concurrently on multiple workers, payloads with the same shard key are always
+// handled by the same worker in the order they are dispatched
+type PayloadDispatcher struct {
+	shards []chan *model.Payload
+	handle func(payload *model.Payload)
+	wg     sync.WaitGroup
+}
+
+// Dispatch Used to queue the payload into its worker without waiting, it returns false when the worker's queue is full so
+// the busy worker doesn't hold back the payloads of the other workers
+func (d *PayloadDispatcher) Dispatch(payload *model.Payload) bool {
+	select {
+	case d.shards[d.shardIndex(PayloadShardKey(payload))] <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop Used to wait all dispatched payloads to be handled, Dispatch should not be called after it
+func (d *PayloadDispatcher) Stop() {
+	for _, shard := range d.shards {
+		close(shard)
+	}
+	d.wg.Wait()
+}
+
+func (d *PayloadDispatcher) shardIndex(key string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(len(d.shards)))
+}
+
+func (d *PayloadDispatcher) work(shard <-chan *model.Payload) {
+	defer d.wg.Done()
+	for payload := range shard {
+		d.handle(payload)
+	}
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"chatto/internal/model"
+)
+
+// newMsgpackPayload Used to get the payload as decoded from MessagePack frame
+func newMsgpackPayload(t *testing.T, data any, sender *model.Client) model.Payload {
+	frame, err := model.MsgpackCodec.Encode(&model.PayloadOutput{Type: model.PayloadMessage, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := model.MsgpackCodec.Decode(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.Payload{Type: input.Type, Data: input.Data, Codec: model.MsgpackCodec, Sender: sender}
+}
+
+func TestPayloadShardKey(t *testing.T) {
+	sender := &model.Client{Id: "client", UserId: "user"}
+	tests := []struct {
+		name    string
+		payload model.Payload
+		want    string
+	}{
+		{
+			name:    "room payload",
+			payload: model.Payload{Data: []byte(`{"room_id":"room"}`), Sender: sender},
+			want:    "room",
+		},
+		{
+			name:    "message payload",
+			payload: model.Payload{Data: []byte(`{"receiver_id":"room"}`), Sender: sender},
+			want:    "room",
+		},
+		{
+			name:    "empty room id",
+			payload: model.Payload{Data: []byte(`{"room_id":""}`), Sender: sender},
+			want:    "user",
+		},
+		{
+			name:    "non-room payload",
+			payload: model.Payload{Data: []byte(`{"user_ids":["other"]}`), Sender: sender},
+			want:    "user",
+		},
+		{
+			name:    "nil data",
+			payload: model.Payload{Sender: sender},
+			want:    "user",
+		},
+		{
+			name:    "malformed data",
+			payload: model.Payload{Data: []byte(`["room"]`), Sender: sender},
+			want:    "user",
+		},
+		{
+			name:    "msgpack room payload",
+			payload: newMsgpackPayload(t, map[string]any{"room_id": "room"}, sender),
+			want:    "room",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PayloadShardKey(&tt.payload); got != tt.want {
+				t.Errorf("PayloadShardKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayloadDispatcher_Order(t *testing.T) {
+	const rooms = 16
+	const payloadsPerRoom = 500
+
+	var mutex sync.Mutex
+	received := make(map[string][]int)
+	dispatcher := NewPayloadDispatcher(4, 10, func(payload *model.Payload) {
+		data, err := model.PayloadData[struct {
+			RoomId string `json:"room_id"`
+			Seq    int    `json:"seq"`
+		}](payload)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mutex.Lock()
+		received[data.RoomId] = append(received[data.RoomId], data.Seq)
+		mutex.Unlock()
+	})
+
+	for i := 0; i < payloadsPerRoom; i++ {
+		for room := 0; room < rooms; room++ {
+			// Retry the full worker like the sender sending the payload again
+			payload := &model.Payload{Data: []byte(fmt.Sprintf(`{"room_id":"room-%d","seq":%d}`, room, i))}
+			for !dispatcher.Dispatch(payload) {
+				runtime.Gosched()
+			}
+		}
+	}
+	dispatcher.Stop()
+
+	if len(received) != rooms {
+		t.Fatalf("received rooms = %v, want %v", len(received), rooms)
+	}
+	for roomId, seqs := range received {
+		if len(seqs) != payloadsPerRoom {
+			t.Fatalf("%s received payloads = %v, want %v", roomId, len(seqs), payloadsPerRoom)
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("%s payload %d has seq %d, the order is not kept", roomId, i, seq)
+			}
+		}
+	}
+}
+
+func TestPayloadDispatcher_FullShard(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 1)
+	dispatcher := NewPayloadDispatcher(2, 1, func(payload *model.Payload) {
+		roomId := PayloadShardKey(payload)
+		if roomId == "busy" {
+			<-release
+			return
+		}
+		handled <- roomId
+	})
+	defer dispatcher.Stop()
+	defer close(release)
+
+	// Find another room handled by the other worker
+	idle := ""
+	for i := 0; len(idle) == 0; i++ {
+		if roomId := fmt.Sprint("room-", i); dispatcher.shardIndex(roomId) != dispatcher.shardIndex("busy") {
+			idle = roomId
+		}
+	}
+
+	busy := &model.Payload{Data: []byte(`{"room_id":"busy"}`)}
+	rejected := false
+	for i := 0; i < 10 && !rejected; i++ {
+		rejected = !dispatcher.Dispatch(busy)
+	}
+	if !rejected {
+		t.Fatal("Dispatch() on the full worker = true, want false")
+	}
+
+	if !dispatcher.Dispatch(&model.Payload{Data: []byte(fmt.Sprintf(`{"room_id":"%s"}`, idle))}) {
+		t.Fatal("Dispatch() on the other worker = false, want true")
+	}
+	select {
+	case roomId := <-handled:
+		if roomId != idle {
+			t.Errorf("handled room = %v, want %v", roomId, idle)
+		}
+	case <-time.After(time.Second):
+		t.Error("payload of the other worker is not handled while the busy worker is full")
+	}
+}
+
+// BenchmarkPayloadDispatcher Simulate payload handling which waits for database, compare the shard counts to see the throughput gain
+func BenchmarkPayloadDispatcher(b *testing.B) {
+	const rooms = 64
+	payloads := make([]*model.Payload, rooms)
+	for i := range payloads {
+		payloads[i] = &model.Payload{Data: []byte(fmt.Sprintf(`{"room_id":"room-%d"}`, i))}
+	}
+
+	for _, shards := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprint("shards-", shards), func(b *testing.B) {
+			dispatcher := NewPayloadDispatcher(shards, 100, func(payload *model.Payload) {
+				time.Sleep(50 * time.Microsecond)
+			})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for !dispatcher.Dispatch(payloads[i%rooms]) {
+					runtime.Gosched()
+				}
+			}
+			dispatcher.Stop()
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"log"
+	"time"
+
+	"chatto/internal/constant"
+	"chatto/internal/service"
+)
+
+// StartIdleHandler Used to periodically mark users with inactive clients as idle, zero duration will disable it
+func StartIdleHandler(chatService service.IChatService, duration time.Duration, stop <-chan struct{}) {
+	if duration == 0 {
+		return
+	}
+
+	handler := &IdleHandler{
+		chatService: chatService,
+		duration:    duration,
+		stop:        stop,
+	}
+
+	go handler.IdleHandle()
+}
+
+type IdleHandler struct {
+	duration time.Duration
+	stop     <-chan struct{}
+
+	chatService service.IChatService
+}
+
+func (i *IdleHandler) IdleHandle() {
+	ticker := time.NewTicker(constant.CLIENT_IDLE_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cerr := i.chatService.CheckIdleClients(i.duration); cerr.IsError() {
+				log.Println(cerr.Error())
+			}
+		case <-i.stop:
+			log.Println("Idle Handler Stopped")
+			return
+		}
+	}
+}
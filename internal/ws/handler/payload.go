@@ -14,110 +14,270 @@ import (
 	"chatto/internal/service"
 )
 
-func StartPayloadHandler(payload <-chan *model.Payload, chatService service.IChatService, roomManager *manager.RoomManager, clientManager *manager.ClientManager) {
+func StartPayloadHandler(shardCount int, payload <-chan *model.Payload, chatService service.IChatService, roomManager *manager.RoomManager, clientManager *manager.ClientManager) *PayloadHandler {
 	handler := &PayloadHandler{
 		payload:       payload,
+		done:          make(chan struct{}),
 		roomManager:   roomManager,
 		clientManager: clientManager,
+		typingManager: manager.NewTypingManager(constant.TYPING_THROTTLE_DURATION, constant.TYPING_EXPIRATION_DURATION),
 		chatService:   chatService,
 	}
+	handler.dispatcher = NewPayloadDispatcher(shardCount, constant.PAYLOAD_SHARD_BUFFER_SIZE, handler.handlePayload)
 	go handler.processPayload()
+	return handler
 }
 
 type PayloadHandler struct {
-	payload <-chan *model.Payload
+	payload    <-chan *model.Payload
+	dispatcher *PayloadDispatcher
+	done       chan struct{}
 
 	// manager should not modify, it is supposed to only read the clients or rooms
 	roomManager   *manager.RoomManager
 	clientManager *manager.ClientManager
+	typingManager manager.TypingManager
 
 	chatService service.IChatService
 }
 
 func (p *PayloadHandler) processPayload() {
 	for payload := range p.payload {
-		switch payload.Type {
-		case model.PayloadTyping:
-			input, err := model.PayloadData[dto.TypingInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleTyping(payload.Sender, input)
-		case model.PayloadMessage:
-			roomChat, err := model.PayloadData[dto.MessageInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleRoomMessage(payload.Sender, &roomChat)
-		case model.PayloadCreateRoom:
-			createRoom, err := model.PayloadData[dto.CreateRoomInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleCreateRoom(payload.Sender, &createRoom)
-		case model.PayloadJoinRoom:
-			joinRoom, err := model.PayloadData[dto.RoomInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleJoinRoom(payload.Sender, joinRoom)
-		case model.PayloadLeaveRoom:
-			// Implicitly remove room when there is only one user there
-			leaveRoom, err := model.PayloadData[dto.RoomInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleLeaveRoom(payload.Sender, leaveRoom)
-		case model.PayloadInviteToRoom:
-			inviteRoom, err := model.PayloadData[dto.MemberRoomInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleInviteToRoom(payload.Sender, inviteRoom)
-		case model.PayloadKickFromRoom:
-			kickRoom, err := model.PayloadData[dto.MemberRoomInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleKickFromRoom(payload.Sender, kickRoom)
-		case model.PayloadGetUsers:
-			getUser, err := model.PayloadData[dto.GetUserInput](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleGetUsers(payload.Sender, &getUser)
-		case model.PayloadGetChats:
-			getChats, err := model.PayloadData[dto.MessageRequest](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleMessageRequest(payload.Sender, &getChats)
-		case model.PayloadGetNotifications:
-			getNotifs, err := model.PayloadData[dto.NotificationRequest](payload)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			p.HandleGetNotifications(payload.Sender, &getNotifs)
-		case model.PayloadGetUserRooms:
-			p.HandleGetUserRooms(payload.Sender)
-		default:
-			output := model.NewErrorPayloadOutput(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
-			payload.Sender.SendPayload(&output)
+		// The sender could send the payload again when the room is not busy anymore
+		if !p.dispatcher.Dispatch(payload) && payload.Sender != nil {
+			util.SendErrorPayload(payload.Sender, common.NewError(common.PAYLOAD_OVERLOADED_ERROR, constant.MSG_PAYLOAD_OVERLOADED))
 		}
 	}
+	p.dispatcher.Stop()
+	close(p.done)
 	log.Println("Closed")
 }
 
+// Done Used to wait until all the payloads are handled after the payload channel is closed
+func (p *PayloadHandler) Done() <-chan struct{} {
+	return p.done
+}
+
+// handlePayload Used to handle each payload, it is called by the dispatcher workers so payloads of different rooms are handled concurrently
+func (p *PayloadHandler) handlePayload(payload *model.Payload) {
+	// The protocol is only negotiated by the first payload
+	if payload.Type == model.PayloadHello {
+		util.SendErrorPayload(payload.Sender, common.NewError(common.PROTOCOL_UNSUPPORTED_PAYLOAD_ERROR, constant.MSG_HELLO_NOT_FIRST))
+		return
+	}
+	if !payload.Sender.Protocol().SupportsPayload(payload.Type) {
+		util.SendErrorPayload(payload.Sender, common.NewError(common.PROTOCOL_UNSUPPORTED_PAYLOAD_ERROR, constant.MSG_UNSUPPORTED_PAYLOAD))
+		return
+	}
+
+	switch payload.Type {
+	case model.PayloadTyping:
+		input, err := model.PayloadData[dto.TypingInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleTyping(payload.Sender, input)
+	case model.PayloadMessage:
+		roomChat, err := model.PayloadData[dto.MessageInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleRoomMessage(payload.Sender, &roomChat)
+	case model.PayloadCreateRoom:
+		createRoom, err := model.PayloadData[dto.CreateRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleCreateRoom(payload.Sender, &createRoom)
+	case model.PayloadOpenDirectRoom:
+		openDirect, err := model.PayloadData[dto.DirectRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleOpenDirectRoom(payload.Sender, openDirect)
+	case model.PayloadOpenGroupRoom:
+		openGroup, err := model.PayloadData[dto.GroupRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleOpenGroupRoom(payload.Sender, openGroup)
+	case model.PayloadJoinRoom:
+		joinRoom, err := model.PayloadData[dto.RoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleJoinRoom(payload.Sender, joinRoom)
+	case model.PayloadLeaveRoom:
+		// Implicitly remove room when there is only one user there
+		leaveRoom, err := model.PayloadData[dto.RoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleLeaveRoom(payload.Sender, leaveRoom)
+	case model.PayloadInviteToRoom:
+		inviteRoom, err := model.PayloadData[dto.MemberRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleInviteToRoom(payload.Sender, inviteRoom)
+	case model.PayloadKickFromRoom:
+		kickRoom, err := model.PayloadData[dto.MemberRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleKickFromRoom(payload.Sender, kickRoom)
+	case model.PayloadTransferRoom:
+		transferRoom, err := model.PayloadData[dto.TransferRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleTransferRoom(payload.Sender, transferRoom)
+	case model.PayloadUpdateRoom:
+		updateRoom, err := model.PayloadData[dto.UpdateRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleUpdateRoom(payload.Sender, &updateRoom)
+	case model.PayloadArchiveRoom:
+		archiveRoom, err := model.PayloadData[dto.RoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleArchiveRoom(payload.Sender, archiveRoom, true)
+	case model.PayloadRestoreRoom:
+		restoreRoom, err := model.PayloadData[dto.RoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleArchiveRoom(payload.Sender, restoreRoom, false)
+	case model.PayloadMuteUser:
+		muteRoom, err := model.PayloadData[dto.MuteRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleMuteUser(payload.Sender, muteRoom)
+	case model.PayloadUnmuteUser:
+		unmuteRoom, err := model.PayloadData[dto.MemberRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleUnmuteUser(payload.Sender, unmuteRoom)
+	case model.PayloadRoomSettings:
+		roomSettings, err := model.PayloadData[dto.RoomSettingsInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleRoomSettings(payload.Sender, roomSettings)
+	case model.PayloadGetUsers:
+		getUser, err := model.PayloadData[dto.GetUserInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleGetUsers(payload.Sender, &getUser)
+	case model.PayloadGetChats:
+		getChats, err := model.PayloadData[dto.MessageRequest](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleMessageRequest(payload.Sender, &getChats)
+	case model.PayloadGetNotifications:
+		getNotifs, err := model.PayloadData[dto.NotificationRequest](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleGetNotifications(payload.Sender, &getNotifs)
+	case model.PayloadBrowseRooms:
+		browseRooms, err := model.PayloadData[dto.BrowseRoomInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleBrowseRooms(payload.Sender, &browseRooms)
+	case model.PayloadGetUserRooms:
+		p.HandleGetUserRooms(payload.Sender)
+	case model.PayloadRoomPreference:
+		roomPreference, err := model.PayloadData[dto.RoomPreferenceInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleRoomPreference(payload.Sender, &roomPreference)
+	case model.PayloadReorderRooms:
+		reorderRooms, err := model.PayloadData[dto.ReorderRoomsInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleReorderRooms(payload.Sender, reorderRooms)
+	case model.PayloadSetPresence:
+		setPresence, err := model.PayloadData[dto.SetPresenceInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleSetPresence(payload.Sender, &setPresence)
+	case model.PayloadGetPresence:
+		getPresence, err := model.PayloadData[dto.GetPresenceInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleGetPresence(payload.Sender, &getPresence)
+	case model.PayloadSubscribePresence:
+		subscribePresence, err := model.PayloadData[dto.PresenceSubscriptionInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleSubscribePresence(payload.Sender, &subscribePresence)
+	case model.PayloadUnsubscribePresence:
+		unsubscribePresence, err := model.PayloadData[dto.PresenceSubscriptionInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleUnsubscribePresence(payload.Sender, &unsubscribePresence)
+	case model.PayloadInviteWorkspace:
+		inviteWorkspace, err := model.PayloadData[dto.WorkspaceMemberInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleInviteWorkspace(payload.Sender, inviteWorkspace)
+	case model.PayloadLeaveWorkspace:
+		leaveWorkspace, err := model.PayloadData[dto.WorkspaceInput](payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		p.HandleLeaveWorkspace(payload.Sender, leaveWorkspace)
+	case model.PayloadGetWorkspaces:
+		p.HandleGetUserWorkspaces(payload.Sender)
+	default:
+		output := model.NewErrorPayloadOutput(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD)
+		payload.Sender.SendPayload(&output)
+	}
+}
+
 func handleForward[T any](p *PayloadHandler, sender *model.Client, types string, data *T) {
 	senders := p.clientManager.GetUniqueClientByUserId(sender)
 	if !containers.IsEmpty(senders) {
@@ -147,11 +307,59 @@ func (p *PayloadHandler) handleNotification(senderUserId string, input *dto.Noti
 }
 
 func (p *PayloadHandler) HandleTyping(sender *model.Client, input dto.TypingInput) {
-	notifInput := dto.NotificationInput{
+	if input.Stop {
+		p.stopTyping(sender, input.RoomId)
+		return
+	}
+
+	// Throttled keystrokes don't need the notification
+	roomId := input.RoomId
+	if !p.typingManager.Start(sender.Id, roomId, func() { p.sendTyping(sender, roomId, model.NotifStopTyping) }) {
+		return
+	}
+
+	notifOutput, cerr := p.chatService.NewNotification(sender.UserId, &dto.NotificationInput{
 		Type:       model.NotifTyping,
-		ReceiverId: input.RoomId,
+		ReceiverId: roomId,
+	})
+	if cerr.IsError() {
+		// Nobody is told about the typing, so the stop event is not needed either
+		p.typingManager.Stop(sender.Id, roomId)
+		log.Println(cerr.Error())
+		return
 	}
-	p.handleNotification(sender.UserId, &notifInput)
+	p.broadcastTyping(sender, roomId, &notifOutput)
+}
+
+// stopTyping Used to send stop typing event when the client is typing on the room
+func (p *PayloadHandler) stopTyping(sender *model.Client, roomId string) {
+	if p.typingManager.Stop(sender.Id, roomId) {
+		p.sendTyping(sender, roomId, model.NotifStopTyping)
+	}
+}
+
+func (p *PayloadHandler) sendTyping(sender *model.Client, roomId string, notifType model.NotificationType) {
+	notifOutput, cerr := p.chatService.NewNotification(sender.UserId, &dto.NotificationInput{
+		Type:       notifType,
+		ReceiverId: roomId,
+	})
+	if cerr.IsError() {
+		log.Println(cerr.Error())
+		return
+	}
+	p.broadcastTyping(sender, roomId, &notifOutput)
+}
+
+// broadcastTyping Used to send typing notification into the room, the typist's own clients are excluded
+func (p *PayloadHandler) broadcastTyping(sender *model.Client, roomId string, notifOutput *dto.NotificationOutput) {
+	room, err := p.roomManager.GetRoomById(roomId)
+	if err != nil {
+		return
+	}
+	payload := model.NewPayloadOutput(model.PayloadNotification, notifOutput)
+	payload.CoalesceKey = model.PayloadTyping + ":" + sender.UserId + ":" + roomId
+	payload.Feature = model.FeatureTyping
+	room.BroadcastExceptUser(&payload, sender.UserId)
 }
 
 func (p *PayloadHandler) HandleRoomMessage(sender *model.Client, input *dto.MessageInput) {
@@ -161,6 +369,9 @@ func (p *PayloadHandler) HandleRoomMessage(sender *model.Client, input *dto.Mess
 		return
 	}
 
+	// Sent message means the sender is no longer typing
+	p.stopTyping(sender, input.ReceiverId)
+
 	// Broadcast
 	room, _ := p.roomManager.GetRoomById(input.ReceiverId)
 	payload := model.NewPayloadOutput(model.PayloadMessage, &messageOutput)
@@ -178,6 +389,24 @@ func (p *PayloadHandler) HandleCreateRoom(sender *model.Client, input *dto.Creat
 	util.SendSuccessPayload(sender, &output)
 }
 
+func (p *PayloadHandler) HandleOpenDirectRoom(sender *model.Client, input dto.DirectRoomInput) {
+	output, cerr := p.chatService.OpenDirectRoom(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendSuccessPayload(sender, &output)
+}
+
+func (p *PayloadHandler) HandleOpenGroupRoom(sender *model.Client, input dto.GroupRoomInput) {
+	output, cerr := p.chatService.OpenGroupRoom(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendSuccessPayload(sender, &output)
+}
+
 func (p *PayloadHandler) HandleJoinRoom(sender *model.Client, input dto.RoomInput) {
 	cerr := p.chatService.JoinRoom(sender, input)
 	if cerr.IsError() {
@@ -260,6 +489,72 @@ func (p *PayloadHandler) HandleKickFromRoom(sender *model.Client, input dto.Memb
 	util.SendNilSuccessPayload(sender)
 }
 
+func (p *PayloadHandler) HandleTransferRoom(sender *model.Client, input dto.TransferRoomInput) {
+	cerr := p.chatService.TransferOwnership(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleUpdateRoom(sender *model.Client, input *dto.UpdateRoomInput) {
+	// Room's members are notified by the chat service
+	_, cerr := p.chatService.UpdateRoom(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+// HandleArchiveRoom Used to handle both archive and restore room, archived is false when the room need to be restored
+func (p *PayloadHandler) HandleArchiveRoom(sender *model.Client, input dto.RoomInput, archived bool) {
+	cerr := p.chatService.SetRoomArchived(sender, input, archived)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleMuteUser(sender *model.Client, input dto.MuteRoomInput) {
+	if input.UserIds == nil || containers.IsEmpty(input.UserIds) {
+		util.SendErrorPayload(sender, common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD))
+		return
+	}
+
+	cerr := p.chatService.MuteUsers(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleUnmuteUser(sender *model.Client, input dto.MemberRoomInput) {
+	if input.UserIds == nil || containers.IsEmpty(input.UserIds) {
+		util.SendErrorPayload(sender, common.NewError(common.PAYLOAD_BAD_FORMAT_ERROR, constant.MSG_BAD_FORMAT_PAYLOAD))
+		return
+	}
+
+	cerr := p.chatService.UnmuteUsers(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleRoomSettings(sender *model.Client, input dto.RoomSettingsInput) {
+	cerr := p.chatService.UpdateRoomSettings(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
 func (p *PayloadHandler) HandleGetUsers(sender *model.Client, input *dto.GetUserInput) {
 	// Send back with the users
 	output, cerr := p.chatService.GetUsersByName(sender, input.Username)
@@ -288,6 +583,15 @@ func (p *PayloadHandler) HandleGetNotifications(sender *model.Client, input *dto
 	util.SendSuccessPayload(sender, &notifs)
 }
 
+func (p *PayloadHandler) HandleBrowseRooms(sender *model.Client, input *dto.BrowseRoomInput) {
+	output, cerr := p.chatService.BrowseRooms(sender.UserId, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendSuccessPayload(sender, &output)
+}
+
 func (p *PayloadHandler) HandleGetUserRooms(sender *model.Client) {
 	rooms, cerr := p.chatService.GetRoomsByUserId(sender.UserId)
 	if cerr.IsError() {
@@ -296,3 +600,84 @@ func (p *PayloadHandler) HandleGetUserRooms(sender *model.Client) {
 	}
 	util.SendSuccessPayload(sender, &rooms)
 }
+
+func (p *PayloadHandler) HandleRoomPreference(sender *model.Client, input *dto.RoomPreferenceInput) {
+	cerr := p.chatService.UpdateRoomPreference(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleReorderRooms(sender *model.Client, input dto.ReorderRoomsInput) {
+	cerr := p.chatService.ReorderRooms(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleSetPresence(sender *model.Client, input *dto.SetPresenceInput) {
+	cerr := p.chatService.SetPresence(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleGetPresence(sender *model.Client, input *dto.GetPresenceInput) {
+	presences, cerr := p.chatService.GetPresences(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendSuccessPayload(sender, &presences)
+}
+
+func (p *PayloadHandler) HandleSubscribePresence(sender *model.Client, input *dto.PresenceSubscriptionInput) {
+	presences, cerr := p.chatService.SubscribePresence(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendSuccessPayload(sender, &presences)
+}
+
+func (p *PayloadHandler) HandleUnsubscribePresence(sender *model.Client, input *dto.PresenceSubscriptionInput) {
+	cerr := p.chatService.UnsubscribePresence(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleInviteWorkspace(sender *model.Client, input dto.WorkspaceMemberInput) {
+	cerr := p.chatService.InviteToWorkspace(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleLeaveWorkspace(sender *model.Client, input dto.WorkspaceInput) {
+	cerr := p.chatService.LeaveWorkspace(sender, input)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendNilSuccessPayload(sender)
+}
+
+func (p *PayloadHandler) HandleGetUserWorkspaces(sender *model.Client) {
+	workspaces, cerr := p.chatService.GetWorkspacesByUserId(sender.UserId)
+	if cerr.IsError() {
+		util.SendErrorPayload(sender, cerr)
+		return
+	}
+	util.SendSuccessPayload(sender, &workspaces)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"log"
+	"time"
+
+	"chatto/internal/service"
+)
+
+// StartReconcileHandler Used to periodically reload the rooms from the database, so the missed membership events are repaired. Zero interval will disable it
+func StartReconcileHandler(chatService service.IChatService, interval time.Duration, stop <-chan struct{}) {
+	if interval == 0 {
+		return
+	}
+
+	handler := &ReconcileHandler{
+		chatService: chatService,
+		interval:    interval,
+		stop:        stop,
+	}
+
+	go handler.ReconcileHandle()
+}
+
+type ReconcileHandler struct {
+	interval time.Duration
+	stop     <-chan struct{}
+
+	chatService service.IChatService
+}
+
+func (r *ReconcileHandler) ReconcileHandle() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cerr := r.chatService.ReconcileRooms(); cerr.IsError() {
+				log.Println(cerr.Error())
+			}
+		case <-r.stop:
+			log.Println("Reconcile Handler Stopped")
+			return
+		}
+	}
+}
@@ -10,6 +10,12 @@ import (
 
 type ClientList map[string]*model.Client
 
+// UserPublisher Used to deliver payloads for the users into the other nodes
+type UserPublisher interface {
+	PublishUsers(payload *model.PayloadOutput, userIds []string, seqs map[string]uint64)
+	PublishPresence(userId string, ownPayload *model.PayloadOutput, publicPayload *model.PayloadOutput)
+}
+
 func NewClientManager() ClientManager {
 	return ClientManager{
 		clientsMutex: sync.RWMutex{},
@@ -20,6 +26,81 @@ func NewClientManager() ClientManager {
 type ClientManager struct {
 	clientsMutex sync.RWMutex
 	clients      ClientList
+
+	// Outbound metrics of the removed clients
+	removedDropped          uint64
+	removedSlowDisconnected uint64
+
+	publisher UserPublisher       // nil on single node
+	recorder  model.EventRecorder // nil when the events are not recorded
+}
+
+// SetPublisher Used to deliver payloads sent by SendToUsers and SendPresence into the other nodes
+func (m *ClientManager) SetPublisher(publisher UserPublisher) {
+	m.clientsMutex.Lock()
+	defer m.clientsMutex.Unlock()
+	m.publisher = publisher
+}
+
+// SetRecorder Used to record the replayable payloads sent by SendToUsers
+func (m *ClientManager) SetRecorder(recorder model.EventRecorder) {
+	m.clientsMutex.Lock()
+	defer m.clientsMutex.Unlock()
+	m.recorder = recorder
+}
+
+// SendToUsers Used to send payload into all clients of the users on every node, the replayable payload is recorded for each user
+func (m *ClientManager) SendToUsers(payload *model.PayloadOutput, userIds ...string) {
+	var seqs map[string]uint64
+	if recorder := m.getRecorder(); recorder != nil && payload.IsReplayable() {
+		seqs = recorder(payload, userIds)
+	}
+
+	m.SendToUsersLocal(payload, userIds, seqs)
+	if publisher := m.getPublisher(); publisher != nil {
+		publisher.PublishUsers(payload, userIds, seqs)
+	}
+}
+
+// SendToUsersLocal Works like SendToUsers, but only the clients on this node. The payload is sent with each user's sequence
+func (m *ClientManager) SendToUsersLocal(payload *model.PayloadOutput, userIds []string, seqs map[string]uint64) {
+	for _, userId := range userIds {
+		for _, client := range m.GetClientsByUserId(userId) {
+			client.SendPayload(payload.WithSeq(seqs[userId]))
+		}
+	}
+}
+
+// SendPresence Used to send user's own presence into its clients and the public presence into the clients subscribing it on every node
+func (m *ClientManager) SendPresence(userId string, ownPayload *model.PayloadOutput, publicPayload *model.PayloadOutput) {
+	m.SendPresenceLocal(userId, ownPayload, publicPayload)
+	if publisher := m.getPublisher(); publisher != nil {
+		publisher.PublishPresence(userId, ownPayload, publicPayload)
+	}
+}
+
+// SendPresenceLocal Works like SendPresence, but only the clients on this node
+func (m *ClientManager) SendPresenceLocal(userId string, ownPayload *model.PayloadOutput, publicPayload *model.PayloadOutput) {
+	m.SendToUsersLocal(ownPayload, []string{userId}, nil)
+	for _, client := range m.GetPresenceSubscribers(userId) {
+		// Own clients already got the actual presence
+		if client.UserId == userId {
+			continue
+		}
+		client.SendPayload(publicPayload)
+	}
+}
+
+func (m *ClientManager) getPublisher() UserPublisher {
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
+	return m.publisher
+}
+
+func (m *ClientManager) getRecorder() model.EventRecorder {
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
+	return m.recorder
 }
 
 func (m *ClientManager) AddClients(clients ...*model.Client) {
@@ -55,6 +136,19 @@ func (m *ClientManager) GetUniqueClientByUserId(client *model.Client) []*model.C
 	return clients
 }
 
+// GetPresenceSubscribers Used to get all clients that subscribe presence changes of the user
+func (m *ClientManager) GetPresenceSubscribers(userId string) []*model.Client {
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
+	clients := make([]*model.Client, 0, 10)
+	for _, c := range m.clients {
+		if c.IsPresenceSubscribed(userId) {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
 func (m *ClientManager) GetClientById(clientId string) (*model.Client, error) {
 	m.clientsMutex.RLock()
 	defer m.clientsMutex.RUnlock()
@@ -73,7 +167,7 @@ func (m *ClientManager) RemoveClientsByUserId(userId string) {
 
 	m.clientsMutex.Lock()
 	for _, c := range clients {
-		delete(m.clients, c.Id)
+		m.removeClient(c)
 	}
 	m.clientsMutex.Unlock()
 }
@@ -85,16 +179,54 @@ func (m *ClientManager) RemoveClientById(clientId string) {
 		return
 	}
 	m.clientsMutex.Lock()
-	delete(m.clients, client.Id)
+	m.removeClient(client)
 	m.clientsMutex.Unlock()
 }
 
+// removeClient Used to delete the client and keep its outbound metrics, it should be called with clientsMutex locked
+func (m *ClientManager) removeClient(client *model.Client) {
+	if _, exist := m.clients[client.Id]; !exist {
+		return
+	}
+	m.removedDropped += client.DroppedCount()
+	if client.IsSlowConsumer() {
+		m.removedSlowDisconnected++
+	}
+	delete(m.clients, client.Id)
+}
+
+// OutboundMetrics Used to get the outbound queue metrics of all clients
+func (m *ClientManager) OutboundMetrics() model.OutboundMetrics {
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
+
+	metrics := model.OutboundMetrics{
+		Clients:          len(m.clients),
+		Dropped:          m.removedDropped,
+		SlowDisconnected: m.removedSlowDisconnected,
+	}
+	for _, c := range m.clients {
+		depth := c.QueueDepth()
+		metrics.QueueDepth += depth
+		if depth > metrics.MaxQueueDepth {
+			metrics.MaxQueueDepth = depth
+		}
+		metrics.Dropped += c.DroppedCount()
+		if c.IsSlowConsumer() {
+			metrics.SlowDisconnected++
+		}
+	}
+	return metrics
+}
+
 func (m *ClientManager) StopClientChannels() {
-	for _, client := range m.clients {
-		close(client.IncomingPayload)
+	for _, client := range m.Clients() {
+		client.CloseOutbound()
 	}
 }
 
 func (m *ClientManager) Clients() []*model.Client {
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
 	return containers.MapValues(m.clients)
 }
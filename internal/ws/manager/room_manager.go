@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"chatto/internal/model"
+	"chatto/internal/util/containers"
 )
 
 type RoomList map[string]*model.ChatRoom
@@ -19,11 +20,60 @@ func NewRoomManager() RoomManager {
 type RoomManager struct {
 	roomsMutex sync.RWMutex
 	rooms      RoomList
+	publisher  model.RoomPublisher
+	recorder   model.EventRecorder
+
+	membershipPublisher MembershipPublisher
+}
+
+// MembershipPublisher Used to tell the other nodes that the rooms or their members are changed
+type MembershipPublisher func(roomIds []string)
+
+func (r *RoomManager) SetMembershipPublisher(publisher MembershipPublisher) {
+	r.roomsMutex.Lock()
+	defer r.roomsMutex.Unlock()
+	r.membershipPublisher = publisher
+}
+
+// PublishMembership Used after the rooms or their members are changed, so the other nodes could reload them
+func (r *RoomManager) PublishMembership(roomIds ...string) {
+	r.roomsMutex.RLock()
+	publisher := r.membershipPublisher
+	r.roomsMutex.RUnlock()
+	if publisher != nil && len(roomIds) != 0 {
+		publisher(roomIds)
+	}
+}
+
+// SetPublisher Used to publish broadcasts of all rooms into the other nodes
+func (r *RoomManager) SetPublisher(publisher model.RoomPublisher) {
+	r.roomsMutex.Lock()
+	defer r.roomsMutex.Unlock()
+	r.publisher = publisher
+	for _, room := range r.rooms {
+		room.SetPublisher(publisher)
+	}
+}
+
+// SetRecorder Used to record the replayable broadcasts of all rooms
+func (r *RoomManager) SetRecorder(recorder model.EventRecorder) {
+	r.roomsMutex.Lock()
+	defer r.roomsMutex.Unlock()
+	r.recorder = recorder
+	for _, room := range r.rooms {
+		room.SetRecorder(recorder)
+	}
 }
 
 func (r *RoomManager) AddRooms(rooms ...*model.ChatRoom) {
 	r.roomsMutex.Lock()
 	for _, room := range rooms {
+		if r.publisher != nil {
+			room.SetPublisher(r.publisher)
+		}
+		if r.recorder != nil {
+			room.SetRecorder(r.recorder)
+		}
 		r.rooms[room.Id] = room
 	}
 	r.roomsMutex.Unlock()
@@ -39,11 +89,17 @@ func (r *RoomManager) GetRoomById(roomId string) (*model.ChatRoom, error) {
 	return room, nil
 }
 
+func (r *RoomManager) Rooms() []*model.ChatRoom {
+	r.roomsMutex.RLock()
+	defer r.roomsMutex.RUnlock()
+	return containers.MapValues(r.rooms)
+}
+
 func (r *RoomManager) GetRoomByName(name string) (*model.ChatRoom, error) {
 	r.roomsMutex.RLock()
 	defer r.roomsMutex.RUnlock()
 	for _, room := range r.rooms {
-		if room.Name == name {
+		if room.Metadata().Name == name {
 			return room, nil
 		}
 	}
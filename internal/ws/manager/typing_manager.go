@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"sync"
+	"time"
+)
+
+func NewTypingManager(throttle time.Duration, expiration time.Duration) TypingManager {
+	return TypingManager{
+		typingsMutex: sync.Mutex{},
+		typings:      make(map[string]*typingState),
+		throttle:     throttle,
+		expiration:   expiration,
+	}
+}
+
+type typingState struct {
+	lastSent time.Time
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// TypingManager Used to track typing state of each client on the room, the state is expired when it is not refreshed
+type TypingManager struct {
+	typingsMutex sync.Mutex
+	typings      map[string]*typingState // key : clientId:roomId
+
+	throttle   time.Duration
+	expiration time.Duration
+}
+
+// Start Used to start or refresh the typing state, onExpire is called when the state is not refreshed until expired.
+// It returns true when the start event should be sent, so the event is sent at most once every throttle duration
+func (t *TypingManager) Start(clientId string, roomId string, onExpire func()) bool {
+	t.typingsMutex.Lock()
+	defer t.typingsMutex.Unlock()
+
+	key := clientId + ":" + roomId
+	now := time.Now()
+	state, exist := t.typings[key]
+	if !exist {
+		state = &typingState{}
+		state.timer = time.AfterFunc(t.expiration, func() {
+			if t.expire(key, state) {
+				onExpire()
+			}
+		})
+		t.typings[key] = state
+	} else {
+		state.timer.Reset(t.expiration)
+	}
+	state.deadline = now.Add(t.expiration)
+
+	if exist && now.Sub(state.lastSent) < t.throttle {
+		return false
+	}
+	state.lastSent = now
+	return true
+}
+
+// Stop Used to remove the typing state, it returns true when the client was typing
+func (t *TypingManager) Stop(clientId string, roomId string) bool {
+	t.typingsMutex.Lock()
+	defer t.typingsMutex.Unlock()
+
+	key := clientId + ":" + roomId
+	state, exist := t.typings[key]
+	if !exist {
+		return false
+	}
+	state.timer.Stop()
+	delete(t.typings, key)
+	return true
+}
+
+// expire Used to remove the typing state when the deadline is passed, the state could be refreshed while the timer is firing
+func (t *TypingManager) expire(key string, state *typingState) bool {
+	t.typingsMutex.Lock()
+	defer t.typingsMutex.Unlock()
+
+	if t.typings[key] != state || time.Now().Before(state.deadline) {
+		return false
+	}
+	delete(t.typings, key)
+	return true
+}
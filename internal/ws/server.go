@@ -1,10 +1,17 @@
 package ws
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"math/rand"
+	"time"
 
 	"chatto/internal/config"
+	"chatto/internal/constant"
+	"chatto/internal/dto"
 	"chatto/internal/model"
+	"chatto/internal/model/common"
 	"chatto/internal/rest/middleware"
 	"chatto/internal/service"
 	"chatto/internal/ws/controller"
@@ -36,6 +43,7 @@ func NewWebsocketServer(config *WebsocketServerConfig) Server {
 		roomManager:   config.RoomManager,
 		payloadChan:   make(chan *model.Payload, 100),
 		clientChan:    make(chan *model.Client),
+		stopChan:      make(chan struct{}),
 		userService:   config.UserService,
 		chatService:   config.ChatService,
 		roomService:   config.RoomService,
@@ -51,6 +59,10 @@ type Server struct {
 	roomManager   *manager.RoomManager
 	payloadChan   chan *model.Payload
 	clientChan    chan *model.Client
+	stopChan      chan struct{}
+
+	clientHandler  *handler.ClientHandler
+	payloadHandler *handler.PayloadHandler
 
 	userService service.IUserService
 	chatService service.IChatService
@@ -61,40 +73,97 @@ type Server struct {
 
 // lookupRooms Should be called when chat service start, it will get all the rooms from room service and create appropriate ChatRoom
 func (s *Server) lookupRooms() error {
-	rooms, err := s.roomService.FindRooms()
+	rooms, err := s.roomService.FindRooms(true)
 	if err.IsError() {
 		return err.Error()
 	}
 
 	for _, room := range rooms {
-		var chatRoom model.ChatRoom
+		var chatRoom *model.ChatRoom
 		if room.Private {
 			chatRoom = model.NewPrivateChatRoom(room.Id, room.Name, room.Description, room.InviteOnly)
 		} else {
 			chatRoom = model.NewChatRoom(room.Id, room.Name, room.Description, room.InviteOnly)
 		}
-		s.roomManager.AddRooms(&chatRoom)
+		dto.UpdateChatRoom(chatRoom, &room)
+
+		// Members are used to record the room events for the disconnected users
+		members, cerr := s.roomService.FindRoomMemberRolesById(room.Id)
+		if cerr.IsError() {
+			return cerr.Error()
+		}
+		for _, member := range members {
+			chatRoom.AddMembers(member.UserId)
+		}
+		s.roomManager.AddRooms(chatRoom)
 	}
 	return nil
 }
 
 func (s *Server) Setup() {
-	handler.StartClientHandler(s.chatService, s.clientChan, s.payloadChan)
-	handler.StartPayloadHandler(s.payloadChan, s.chatService, s.roomManager, s.clientManager)
+	s.clientHandler = handler.StartClientHandler(s.cfg, s.chatService, s.clientChan, s.payloadChan, s.stopChan)
+	s.payloadHandler = handler.StartPayloadHandler(s.cfg.PayloadShards, s.payloadChan, s.chatService, s.roomManager, s.clientManager)
+	handler.StartIdleHandler(s.chatService, time.Duration(s.cfg.IdleTimeout)*time.Minute, s.stopChan)
+	if s.cfg.ClusterMode {
+		handler.StartReconcileHandler(s.chatService, time.Duration(s.cfg.ReconcileInterval)*time.Minute, s.stopChan)
+	}
 
 	if err := s.lookupRooms(); err != nil {
 		panic(fmt.Sprint("Error on lookupRooms: ", err))
 	}
 	// Set redis indexes
 
-	websocketHandler := controller.NewWebsocketHandler(s.clientChan)
+	websocketHandler := controller.NewWebsocketHandler(s.cfg, s.clientChan, s.stopChan)
 	websocketHandler.Route(s.router, s.middlewares)
 }
 
-func (s *Server) Stop() {
+// Stop Used to drain the clients gracefully, new clients are rejected and the queued payloads are written until the context is done.
+// The clients are told to reconnect before the connections are closed with going away status
+func (s *Server) Stop(ctx context.Context) {
+	close(s.stopChan)
+
+	// Handle the payloads already read, so the responses are queued before the connections are closed
+	s.clientHandler.StopReading(s.clientManager)
 	close(s.payloadChan)
-	close(s.clientChan)
+	select {
+	case <-s.payloadHandler.Done():
+	case <-ctx.Done():
+		log.Println("Payload handler is not stopped: ", ctx.Err())
+	}
 
-	s.chatService.ClearUsers()
+	clients := s.clientManager.Clients()
+	for _, client := range clients {
+		// Randomize the delay so the clients don't reconnect at once
+		delay := time.Duration(rand.Int63n(int64(constant.SHUTDOWN_RECONNECT_DELAY)))
+		response := dto.NewGoingAwayResponse(constant.CLOSE_REASON_SHUTDOWN, delay)
+		output := model.NewPayloadOutput(model.PayloadGoingAway, &response)
+		client.SendPayload(&output)
+	}
 	s.clientManager.StopClientChannels()
+
+	writersDone := make(chan struct{})
+	go func() {
+		s.clientHandler.WaitWriters()
+		close(writersDone)
+	}()
+	select {
+	case <-writersDone:
+	case <-ctx.Done():
+		// Force closing the clients that are still writing
+		log.Println("Outbound queues are not flushed: ", ctx.Err())
+		for _, client := range clients {
+			_ = client.Conn.Close()
+		}
+	}
+
+	// The other nodes still have connected clients
+	var cerr common.Error
+	if s.cfg.ClusterMode {
+		cerr = s.chatService.ClearLocalClients()
+	} else {
+		cerr = s.chatService.ClearUsers()
+	}
+	if cerr.IsError() {
+		log.Println(cerr.Error())
+	}
 }